@@ -11,11 +11,12 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
-func loadOrCreateDb(pwFile string, settings *passu.PromptSettings) (*passulib.PasswordDatabase, error) {
+func loadOrCreateDb(pwFile string, attempts int, settings *passu.PromptSettings) (*passulib.PasswordDatabase, error) {
 	if stat, err := os.Stat(pwFile); !os.IsNotExist(err) {
-		fmt.Println("Opening password file.")
+		fmt.Fprintln(os.Stderr, "Opening password file.")
 
 		f, err := os.Open(pwFile)
 		if err != nil {
@@ -29,30 +30,48 @@ func loadOrCreateDb(pwFile string, settings *passu.PromptSettings) (*passulib.Pa
 			return nil, err
 		}
 
-		pwInput, err := settings.RL.ReadPassword("Master password: ")
-		if err != nil {
-			return nil, err
-		}
+		var db *passulib.PasswordDatabase
+		for attempt := 1; ; attempt++ {
+			pwInput, err := passu.ReadMasterPassword("Master password: ", settings)
+			if err != nil {
+				return nil, err
+			}
 
-		db, err := passulib.PasswordDatabaseFromData(bytes, string(pwInput))
-		if err != nil {
-			return nil, err
+			db, err = passu.OpenDatabase(bytes, pwInput)
+			if err == nil {
+				settings.MasterPassword = pwInput
+				break
+			}
+
+			// Passwords from non-interactive sources would be the same on every attempt
+			if !errors.Is(err, passu.ErrWrongPassword) || settings.PasswordSource != nil || attempt >= attempts {
+				return nil, err
+			}
+
+			delay := time.Duration(1<<uint(attempt-1)) * time.Second
+			fmt.Fprintf(os.Stderr, "%v. Try again in %v.\n", err, delay)
+			time.Sleep(delay)
 		}
+		settings.FileState = passu.FileStateFromData(bytes, stat.ModTime())
 
 		return db, nil
+	} else if settings.ReadOnly {
+		return nil, fmt.Errorf("%w. File does not exist and cannot be created.", passu.ErrReadOnly)
 	} else {
-		fmt.Println("File does not exist. Creating new password database.")
+		fmt.Fprintln(os.Stderr, "File does not exist. Creating new password database.")
 
-		pwBytes, err := settings.RL.ReadPassword("Master password: ")
+		pwInput, err := passu.ReadMasterPassword("Master password: ", settings)
 		if err != nil {
 			return nil, err
 		}
-		pwBytesConfirm, err := settings.RL.ReadPassword("Confirm password: ")
-		if err != nil {
-			return nil, err
+		pwInputConfirm := pwInput
+		if settings.PasswordSource == nil {
+			pwBytesConfirm, err := settings.RL.ReadPassword("Confirm password: ")
+			if err != nil {
+				return nil, err
+			}
+			pwInputConfirm = string(pwBytesConfirm)
 		}
-		pwInput := string(pwBytes)
-		pwInputConfirm := string(pwBytesConfirm)
 
 		if strings.TrimSpace(pwInput) == "" {
 			return nil, errors.New("Password cannot be empty.")
@@ -62,16 +81,62 @@ func loadOrCreateDb(pwFile string, settings *passu.PromptSettings) (*passulib.Pa
 		}
 
 		db := passulib.NewPasswordDatabase(pwInput)
+		settings.MasterPassword = pwInput
 		data := db.Save()
 		err = settings.WriteFileFunc(data)
 		if err != nil {
 			return nil, err
 		}
+		settings.FileState, err = passu.ReadFileState(pwFile)
+		if err != nil {
+			return nil, err
+		}
 
 		return db, nil
 	}
 }
 
+func acquireLock(pwFile string, settings *passu.PromptSettings) (*passu.FileLock, error) {
+	for {
+		lock, err := passu.LockFile(pwFile)
+		lockErr, ok := err.(*passu.LockedError)
+		if !ok {
+			return lock, err
+		}
+
+		// Nobody can answer the question when the password comes from a script or there is no terminal
+		if settings.PasswordSource != nil || !readline.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, lockErr
+		}
+
+		if lockErr.Stale() {
+			settings.InstructFunc(fmt.Sprintf("%v, which is no longer running.", lockErr))
+		} else {
+			settings.InstructFunc(fmt.Sprintf("%v.", lockErr))
+		}
+
+		settings.RL.SetPrompt("Open [r]ead-only, [b]reak lock or [q]uit: ")
+		inp, err := settings.RL.Readline()
+		settings.RL.SetPrompt(settings.PromptText)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(inp)) {
+		case "r":
+			settings.ReadOnly = true
+			return nil, nil
+		case "b":
+			err = passu.BreakLock(pwFile)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lockErr
+		}
+	}
+}
+
 func main() {
 	app := cli.NewApp()
 
@@ -79,41 +144,182 @@ func main() {
 	app.Usage = "Simple password manager"
 	app.HideVersion = true
 	app.ArgsUsage = "<password-file> [command...]"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "backup-dir",
+			Usage: "Directory for database backups (default: directory of the password file)",
+		},
+		cli.IntFlag{
+			Name:  "backup-keep",
+			Value: 10,
+			Usage: "Number of most recent backups to keep. 0 keeps all backups",
+		},
+		cli.IntFlag{
+			Name:  "backup-daily",
+			Value: 7,
+			Usage: "Number of days for which one backup per day is kept",
+		},
+		cli.IntFlag{
+			Name:  "backup-weekly",
+			Value: 4,
+			Usage: "Number of weeks for which one backup per week is kept",
+		},
+		cli.BoolFlag{
+			Name:  "auto-reload",
+			Usage: "Reload the database in the interactive prompt when the file changes on disk and there are no unsaved changes",
+		},
+	}
+	app.Flags = append(app.Flags, passwordFlags...)
+	app.Flags = append(app.Flags, cli.StringFlag{
+		Name:  "format",
+		Value: passu.FormatText,
+		Usage: "Output format of commands: text, json or yaml",
+	})
+	app.Before = func(c *cli.Context) error {
+		if !passu.ValidFormat(c.String("format")) {
+			return fmt.Errorf("Unknown output format %q", c.String("format"))
+		}
+		return nil
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:      "merge",
+			Usage:     "Three-way merge of password files. Can be used as a git merge driver",
+			ArgsUsage: "<base> <ours> <theirs>",
+			Action: func(c *cli.Context) error {
+				if c.NArg() < 3 {
+					return fmt.Errorf("%w: <base> <ours> <theirs>. Use -h option for help.", passu.ErrMissingArgument)
+				}
+
+				settings := passu.PromptSettings{}
+				settings.Format = c.GlobalString("format")
+				settings.PromptText = "merge> "
+				settings.RL, _ = readline.New(settings.PromptText)
+
+				var err error
+				settings.PasswordSource, err = passwordSource(c)
+				if err != nil {
+					return err
+				}
+				settings.PrintFunc = func(text string) {
+					fmt.Println(text)
+				}
+				settings.InstructFunc = func(text string) {
+					fmt.Fprintln(os.Stderr, text)
+				}
+
+				return passu.MergeFiles(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), &settings)
+			},
+		},
+		{
+			Name:      "diff",
+			Usage:     "Show differences between two password files",
+			ArgsUsage: "<from> <to>",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "reveal, r",
+					Usage: "Show changed passwords",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.NArg() < 2 {
+					return fmt.Errorf("%w: <from> <to>. Use -h option for help.", passu.ErrMissingArgument)
+				}
+
+				settings := passu.PromptSettings{}
+				settings.Format = c.GlobalString("format")
+				settings.PromptText = "diff> "
+				settings.RL, _ = readline.New(settings.PromptText)
+
+				var err error
+				settings.PasswordSource, err = passwordSource(c)
+				if err != nil {
+					return err
+				}
+				settings.PrintFunc = func(text string) {
+					fmt.Println(text)
+				}
+				settings.InstructFunc = func(text string) {
+					fmt.Fprintln(os.Stderr, text)
+				}
+
+				return passu.DiffFiles(c.Args().Get(0), c.Args().Get(1), c.Bool("reveal"), &settings)
+			},
+		},
+		{
+			Name:      "completion",
+			Usage:     "Print a shell completion script",
+			ArgsUsage: "bash|zsh|fish",
+			Action: func(c *cli.Context) error {
+				if c.NArg() < 1 {
+					return fmt.Errorf("%w: bash|zsh|fish. Use -h option for help.", passu.ErrMissingArgument)
+				}
+
+				return passu.WriteCompletionScript(os.Stdout, c.Args().Get(0), app)
+			},
+		},
+	}
 
 	app.Action = func(c *cli.Context) error {
 		if c.NArg() < 1 {
-			return errors.New("Missing password file argument. Use -h option for help.")
+			return fmt.Errorf("%w: <password-file>. Use -h option for help.", passu.ErrMissingArgument)
 		}
 
 		pwFile := c.Args().Get(0)
 
 		settings := passu.PromptSettings{}
 		settings.FilePath = pwFile
+		settings.Format = c.String("format")
+		settings.AutoReload = c.Bool("auto-reload")
+		settings.Backup = passu.BackupSettings{
+			Dir:    c.String("backup-dir"),
+			Keep:   c.Int("backup-keep"),
+			Daily:  c.Int("backup-daily"),
+			Weekly: c.Int("backup-weekly"),
+		}
 		settings.PromptText = fmt.Sprintf("%v> ", path.Base(settings.FilePath))
 		settings.RL, _ = readline.New(settings.PromptText)
 
 		settings.PrintFunc = func(text string) {
 			fmt.Println(text)
 		}
+		settings.InstructFunc = func(text string) {
+			fmt.Fprintln(os.Stderr, text)
+		}
 		settings.WriteFileFunc = func(data []byte) error {
-			f, err := os.Create(settings.FilePath)
+			err := passu.BackupFile(settings.FilePath, settings.Backup)
 			if err != nil {
 				return err
 			}
-			defer f.Close()
-
-			_, err = f.Write(data)
-			if err != nil {
-				return err
-			}
-
-			return nil
+			return passu.WriteFileAtomic(settings.FilePath, data, settings.MasterPassword)
 		}
 		settings.CopyFunc = func(text string) error {
 			return clipboard.WriteAll(text)
 		}
 
-		db, err := loadOrCreateDb(pwFile, &settings)
+		var err error
+		settings.PasswordSource, err = passwordSource(c)
+		if err != nil {
+			return err
+		}
+		if c.Bool("password-stdin") && c.NArg() < 2 {
+			return errors.New("The interactive prompt cannot be used with --password-stdin. Give a command to run after the password file.")
+		}
+
+		lock, err := acquireLock(pwFile, &settings)
+		if err != nil {
+			return err
+		}
+		if lock != nil {
+			defer lock.Unlock()
+		}
+		if settings.ReadOnly {
+			settings.PromptText = fmt.Sprintf("%v (read-only)> ", path.Base(settings.FilePath))
+			settings.RL.SetPrompt(settings.PromptText)
+		}
+
+		db, err := loadOrCreateDb(pwFile, c.Int("password-attempts"), &settings)
 		if err != nil {
 			return err
 		}
@@ -131,6 +337,7 @@ func main() {
 
 	err := app.Run(os.Args)
 	if err != nil {
-		fmt.Println("ERROR:", err)
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		os.Exit(passu.ExitCode(err))
 	}
 }
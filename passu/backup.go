@@ -0,0 +1,251 @@
+package passu
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405.000"
+
+// BackupSettings control where database backups are stored and how many of them are kept.
+// Pruning is disabled when Keep is zero or less.
+type BackupSettings struct {
+	Dir    string // Directory for backups. Defaults to the directory of the database file.
+	Keep   int    // Number of most recent backups that are always kept
+	Daily  int    // Number of days for which the newest backup of each day is kept
+	Weekly int    // Number of weeks for which the newest backup of each week is kept
+}
+
+type Backup struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+func backupDir(filePath string, settings BackupSettings) string {
+	if settings.Dir != "" {
+		return settings.Dir
+	}
+	return filepath.Dir(filePath)
+}
+
+// ListBackups returns the backups of the given database file, newest first.
+func ListBackups(filePath string, settings BackupSettings) ([]Backup, error) {
+	files, err := ioutil.ReadDir(backupDir(filePath, settings))
+	if os.IsNotExist(err) {
+		return []Backup{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(filePath) + "."
+	backups := make([]Backup, 0)
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".bak"), time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, Backup{
+			Path: filepath.Join(backupDir(filePath, settings), name),
+			Time: t,
+			Size: file.Size(),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// BackupFile copies the current contents of the database file into a timestamped backup
+// and prunes old backups according to settings. Nothing is done if the file does not exist yet.
+func BackupFile(filePath string, settings BackupSettings) error {
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	dir := backupDir(filePath, settings)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%v.%v.bak", filepath.Base(filePath), time.Now().Format(backupTimeFormat))
+	err = ioutil.WriteFile(filepath.Join(dir, name), data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return PruneBackups(filePath, settings)
+}
+
+// PruneBackups removes the backups that fall outside the retention policy of settings.
+func PruneBackups(filePath string, settings BackupSettings) error {
+	if settings.Keep <= 0 {
+		return nil
+	}
+
+	backups, err := ListBackups(filePath, settings)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	for idx, backup := range backups {
+		day := backup.Time.Format("2006-01-02")
+		year, week := backup.Time.ISOWeek()
+		weekKey := fmt.Sprintf("%v-%v", year, week)
+
+		keep := idx < settings.Keep
+		if !days[day] && now.Sub(backup.Time) < time.Duration(settings.Daily)*24*time.Hour {
+			keep = true
+		}
+		if !weeks[weekKey] && now.Sub(backup.Time) < time.Duration(settings.Weekly)*7*24*time.Hour {
+			keep = true
+		}
+		days[day] = true
+		weeks[weekKey] = true
+
+		if !keep {
+			err = os.Remove(backup.Path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func openBackup(backup Backup, settings *PromptSettings) (*passulib.PasswordDatabase, error) {
+	data, err := ioutil.ReadFile(backup.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The backup may predate a master password change
+	backupDb, _, err := openDatabaseData(data, "Backup password: ", settings)
+	return backupDb, err
+}
+
+func backupArgument(c *cli.Context, settings *PromptSettings) (Backup, error) {
+	if c.NArg() < 1 {
+		return Backup{}, missingArgument("backup number")
+	}
+
+	num, err := strconv.Atoi(c.Args().Get(0))
+	if err != nil {
+		return Backup{}, errors.New("Invalid backup number")
+	}
+
+	backups, err := ListBackups(settings.FilePath, settings.Backup)
+	if err != nil {
+		return Backup{}, err
+	}
+	if num < 1 || num > len(backups) {
+		return Backup{}, errors.New("Backup not found")
+	}
+
+	return backups[num-1], nil
+}
+
+func backupCommands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Command {
+	return []cli.Command{
+		{
+			Name:    "list",
+			Usage:   "List backups of the database file",
+			Aliases: []string{"l"},
+			Action: func(c *cli.Context) error {
+				backups, err := ListBackups(settings.FilePath, settings.Backup)
+				if err != nil {
+					return err
+				}
+
+				data := make([]backupOutput, len(backups))
+				for idx, backup := range backups {
+					data[idx] = backupOutput{Number: idx + 1, Time: backup.Time.Format(time.RFC3339), Size: backup.Size}
+				}
+
+				return printData(settings, data, func() {
+					if len(backups) == 0 {
+						settings.PrintFunc("No backups found")
+					}
+					for idx, backup := range backups {
+						settings.PrintFunc(fmt.Sprintf("%v: %v (%v bytes)", idx+1, backup.Time.Format("2006-01-02 15:04:05"), backup.Size))
+					}
+				})
+			},
+		},
+		{
+			Name:      "diff",
+			Usage:     "Show changes made since a backup",
+			ArgsUsage: "<number>",
+			Aliases:   []string{"d"},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "reveal, r",
+					Usage: "Show changed passwords",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				backup, err := backupArgument(c, settings)
+				if err != nil {
+					return err
+				}
+
+				backupDb, err := openBackup(backup, settings)
+				if err != nil {
+					return err
+				}
+
+				return printDatabaseDiff(backupDb, db, c.Bool("reveal"), settings)
+			},
+		},
+		{
+			Name:      "restore",
+			Usage:     "Replace the open database contents with a backup",
+			ArgsUsage: "<number>",
+			Aliases:   []string{"r"},
+			Action: func(c *cli.Context) error {
+				backup, err := backupArgument(c, settings)
+				if err != nil {
+					return err
+				}
+
+				backupDb, err := openBackup(backup, settings)
+				if err != nil {
+					return err
+				}
+
+				err = replaceContents(db, backupDb)
+				if err != nil {
+					return err
+				}
+
+				printMessage(settings, fmt.Sprintf("Backup from %v restored. Save the database to keep the changes.", backup.Time.Format("2006-01-02 15:04:05")))
+				return nil
+			},
+		},
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/urfave/cli"
 	"github.com/winded/passu-lib"
 	"io"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,7 +24,7 @@ func promptInt(prompt string, settings *PromptSettings) null.Int {
 			return null.IntFrom(int64(val))
 		}
 
-		fmt.Println("Could not parse value. Using default")
+		printInstruction(settings, "Could not parse value. Using default")
 	}
 
 	return null.NewInt(0, false)
@@ -42,8 +43,16 @@ func promptBool(prompt string, settings *PromptSettings) null.Bool {
 	}
 }
 
+func promptChoice(prompt string, settings *PromptSettings) string {
+	settings.RL.SetPrompt(prompt)
+	defer settings.RL.SetPrompt(settings.PromptText)
+
+	inp, _ := settings.RL.Readline()
+	return strings.ToLower(strings.TrimSpace(inp))
+}
+
 func commands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Command {
-	return []cli.Command{
+	cmds := []cli.Command{
 		{
 			Name:    "change-master-password",
 			Usage:   "Change database password",
@@ -59,7 +68,8 @@ func commands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Com
 				}
 
 				db.SetPassword(string(newPassword))
-				settings.PrintFunc("Master password changed. Please save the database to use the new password.")
+				settings.MasterPassword = string(newPassword)
+				printMessage(settings, "Master password changed. Please save the database to use the new password.")
 				return nil
 			},
 		},
@@ -92,10 +102,17 @@ func commands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Com
 
 						useString := strings.Join(useStrings, ", ")
 
-						settings.PrintFunc(fmt.Sprint("Length: ", length))
-						settings.PrintFunc(fmt.Sprint("Characters: ", useString))
-
-						return nil
+						data := policyOutput{
+							Length:    length,
+							Lowercase: policy.UseLowercase.Bool,
+							Uppercase: policy.UseUppercase.Bool,
+							Numbers:   policy.UseNumbers.Bool,
+							Special:   policy.UseSpecial.Bool,
+						}
+						return printData(settings, data, func() {
+							settings.PrintFunc(fmt.Sprint("Length: ", length))
+							settings.PrintFunc(fmt.Sprint("Characters: ", useString))
+						})
 					},
 				},
 				{
@@ -105,7 +122,7 @@ func commands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Com
 					Action: func(c *cli.Context) error {
 						policy := db.GetDefaultPolicy()
 
-						settings.PrintFunc("Enter new policy values (leave blank to not change)")
+						printInstruction(settings, "Enter new policy values (leave blank to not change)")
 
 						policy.Length = promptInt("Length: ", settings)
 						policy.UseLowercase = promptBool("Use Lowercase [y/n]: ", settings)
@@ -124,17 +141,44 @@ func commands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Com
 			Aliases:     []string{"pw"},
 			Subcommands: passwordCommands(db, settings),
 		},
+		{
+			Name:        "backups",
+			Usage:       "Manage backups of the database file",
+			Aliases:     []string{"bk"},
+			Subcommands: backupCommands(db, settings),
+		},
+		mergeCommand(db, settings),
+		diffCommand(db, settings),
 		{
 			Name:  "save",
 			Usage: "Save the password database to file",
 			Action: func(c *cli.Context) error {
+				if settings.ReadOnly {
+					return ErrReadOnly
+				}
+
+				changed, err := fileChanged(settings, false)
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				if changed {
+					proceed, err := resolveFileChange(db, settings)
+					if err != nil || !proceed {
+						return err
+					}
+				}
+
 				bytes := db.Save()
-				err := settings.WriteFileFunc(bytes)
+				err = settings.WriteFileFunc(bytes)
 				if err != nil {
 					return err
 				}
+				if state, err := ReadFileState(settings.FilePath); err == nil {
+					settings.FileState = state
+				}
+				sessionJournal(db, settings).markSaved(db, settings)
 
-				fmt.Println("Password database saved to ", settings.FilePath)
+				printMessage(settings, fmt.Sprint("Password database saved to ", settings.FilePath))
 				return nil
 			},
 		},
@@ -149,40 +193,63 @@ func commands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Com
 				},
 			},
 			Action: func(c *cli.Context) error {
-				if db.Modified && !c.Bool("force") {
-					fmt.Println("Unsaved changes detected. Please save your password database using \"save\", or exit without saving using the \"-f\" option")
-				} else {
-					settings.ExitFunc()
+				if db.Modified && !settings.ReadOnly && !c.Bool("force") {
+					return fmt.Errorf("%w. Please save your password database using \"save\", or exit without saving using the \"-f\" option", ErrUnsavedChanges)
 				}
+
+				settings.ExitFunc()
 				return nil
 			},
 		},
 	}
+	cmds = append(cmds, folderCommands(db, settings)...)
+	return append(cmds, journalCommands(db, settings)...)
 }
 
 func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Command {
 	return []cli.Command{{
-		Name:    "list",
-		Usage:   "List password entries",
-		Aliases: []string{"l"},
+		Name:      "list",
+		Usage:     "List password entries",
+		ArgsUsage: "[folder]",
+		Aliases:   []string{"l"},
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "tree, t",
+				Usage: "Show folders as a tree",
+			},
+		},
 		Action: func(c *cli.Context) error {
-			entries := db.AllEntries()
-			if len(entries) == 0 {
-				settings.PrintFunc("No entries found")
-				return nil
+			folder := settings.CurrentFolder
+			if c.NArg() >= 1 {
+				folder = strings.TrimSuffix(resolveName(c.Args().Get(0), settings), "/")
 			}
+			entries := entriesInFolder(db, folder)
 
 			entryNames := make([]string, len(entries))
 			for idx, entry := range entries {
-				entryNames[idx] = entry.Name
+				entryNames[idx] = relativeName(entry.Name, folder)
 			}
-
 			sort.Strings(entryNames)
-			for _, name := range entryNames {
-				settings.PrintFunc(name)
-			}
 
-			return nil
+			data := make([]entrySummaryOutput, len(entries))
+			for idx, entry := range entries {
+				data[idx] = entrySummaryOutput{Name: entry.Name}
+			}
+			sort.Slice(data, func(i, j int) bool {
+				return data[i].Name < data[j].Name
+			})
+
+			return printData(settings, data, func() {
+				if len(entryNames) == 0 {
+					settings.PrintFunc("No entries found")
+				} else if c.Bool("tree") {
+					printTree(entryNames, settings)
+				} else {
+					for _, name := range entryNames {
+						settings.PrintFunc(name)
+					}
+				}
+			})
 		},
 	},
 		{
@@ -191,11 +258,10 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 			ArgsUsage: "<name> [description]",
 			Aliases:   []string{"n"},
 			Action: func(c *cli.Context) error {
-				if c.NArg() < 1 {
-					return errors.New("Missing name argument")
+				name, err := entryArgument(c, settings)
+				if err != nil {
+					return err
 				}
-
-				name := c.Args().Get(0)
 				description := ""
 				if c.NArg() >= 2 {
 					description = c.Args().Get(1)
@@ -224,7 +290,7 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 					}
 				}
 
-				settings.PrintFunc("Password added")
+				printMessage(settings, "Password added")
 				return nil
 			},
 		},
@@ -240,29 +306,31 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 				},
 			},
 			Action: func(c *cli.Context) error {
-				if c.NArg() < 1 {
-					return errors.New("Missing name argument")
-				}
-
-				entry, idx := db.GetEntry(c.Args().Get(0))
-				if idx == -1 {
-					return errors.New("Entry not found")
+				entry, err := findEntry(c, db, settings)
+				if err != nil {
+					return err
 				}
 
 				if c.Bool("pass-only") {
-					settings.PrintFunc(entry.Password)
-					return nil
+					return printData(settings, passwordOutput{Name: entry.Name, Password: entry.Password}, func() {
+						settings.PrintFunc(entry.Password)
+					})
 				}
 
-				settings.PrintFunc(fmt.Sprintf("Name: %v", entry.Name))
-				settings.PrintFunc(fmt.Sprintf("Password: (%v characters)", len(entry.Password)))
-				if entry.Description != "" {
-					settings.PrintFunc(fmt.Sprintf("Description: \n %v", entry.Description))
-				} else {
-					settings.PrintFunc("No description")
+				data := entryOutput{
+					Name:           entry.Name,
+					PasswordLength: len(entry.Password),
+					Description:    entry.Description,
 				}
-
-				return nil
+				return printData(settings, data, func() {
+					settings.PrintFunc(fmt.Sprintf("Name: %v", entry.Name))
+					settings.PrintFunc(fmt.Sprintf("Password: (%v characters)", len(entry.Password)))
+					if entry.Description != "" {
+						settings.PrintFunc(fmt.Sprintf("Description: \n %v", entry.Description))
+					} else {
+						settings.PrintFunc("No description")
+					}
+				})
 			},
 		},
 		{
@@ -271,21 +339,17 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 			ArgsUsage: "<name>",
 			Aliases:   []string{"cp"},
 			Action: func(c *cli.Context) error {
-				if c.NArg() < 1 {
-					return errors.New("Missing name argument")
-				}
-
-				entry, idx := db.GetEntry(c.Args().Get(0))
-				if idx == -1 {
-					return errors.New("Entry not found")
+				entry, err := findEntry(c, db, settings)
+				if err != nil {
+					return err
 				}
 
-				err := settings.CopyFunc(entry.Password)
+				err = settings.CopyFunc(entry.Password)
 				if err != nil {
 					return err
 				}
 
-				settings.PrintFunc("Password copied to clipboard")
+				printMessage(settings, "Password copied to clipboard")
 				return nil
 			},
 		},
@@ -309,17 +373,14 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 				},
 			},
 			Action: func(c *cli.Context) error {
-				if c.NArg() < 1 {
-					return errors.New("Missing name argument")
-				}
-
-				entry, idx := db.GetEntry(c.Args().Get(0))
-				if idx == -1 {
-					return errors.New("Entry not found")
+				entry, err := findEntryToChange(c, db, settings)
+				if err != nil {
+					return err
 				}
+				name := entry.Name
 
 				if c.IsSet("new-name") {
-					entry.Name = c.String("new-name")
+					entry.Name = resolveName(c.String("new-name"), settings)
 				}
 				if c.IsSet("description") {
 					entry.Description = c.String("description")
@@ -333,7 +394,7 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 					entry.Password = string(newPassword)
 				}
 
-				err := db.UpdateEntry(c.Args().Get(0), entry)
+				err = db.UpdateEntry(name, entry)
 				if err != nil {
 					return err
 				}
@@ -345,7 +406,7 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 					}
 				}
 
-				settings.PrintFunc("Entry updated")
+				printMessage(settings, "Entry updated")
 				return nil
 			},
 		},
@@ -354,20 +415,48 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 			Usage:     "Delete a password entry",
 			ArgsUsage: "<name>",
 			Aliases:   []string{"d"},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Delete without asking for confirmation",
+				},
+			},
 			Action: func(c *cli.Context) error {
-				if c.NArg() < 1 {
-					return errors.New("Missing name argument")
+				name, err := existingEntryArgument(c, db, settings)
+				if err != nil {
+					return err
 				}
 
-				_, err := db.RemoveEntry(c.Args().Get(0))
+				// Without confirmation, only an exact name is accepted
+				if c.Bool("yes") {
+					_, idx := db.GetEntry(name)
+					if idx == -1 {
+						return entryNotFound(db, name)
+					}
+				} else {
+					entry, err := lookupEntry(db, name, settings)
+					if err != nil {
+						return err
+					}
+					name = entry.Name
+
+					confirm := promptBool(fmt.Sprintf("Delete entry %v? [y/n]: ", name), settings)
+					if !confirm.Valid || !confirm.Bool {
+						return errors.New("Deletion cancelled")
+					}
+				}
+
+				_, err = db.RemoveEntry(name)
 				if err != nil {
 					return err
 				}
 
-				settings.PrintFunc("Entry removed")
+				printMessage(settings, "Entry removed")
 				return nil
 			},
 		},
+		moveCommand(db, settings),
+		searchCommand(db, settings),
 		{
 			Name:    "policy",
 			Aliases: []string{"p"},
@@ -378,45 +467,63 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 					ArgsUsage: "<name>",
 					Aliases:   []string{"v"},
 					Action: func(c *cli.Context) error {
-						if c.NArg() < 1 {
-							return errors.New("Missing name argument")
-						}
-
-						entry, idx := db.GetEntry(c.Args().Get(0))
-						if idx == -1 {
-							return errors.New("Entry not found")
+						entry, err := findEntry(c, db, settings)
+						if err != nil {
+							return err
 						}
 
 						policy := entry.PolicyOverride
 						defaultPolicy := db.GetDefaultPolicy()
 
-						sLength := fmt.Sprintf("%v (default)", defaultPolicy.Length.ValueOrZero())
-						if policy.Length.Valid {
-							sLength = fmt.Sprintf("%v", policy.Length.ValueOrZero())
+						data := policyOutput{Inherited: make([]string, 0)}
+						resolveBool := func(value, defaultValue null.Bool, field string) bool {
+							if value.Valid {
+								return value.Bool
+							}
+							data.Inherited = append(data.Inherited, field)
+							return defaultValue.Bool
 						}
-
-						appendUseString := func(strings []string, value, defaultValue null.Bool, text string) []string {
-							if value.Valid && value.Bool {
-								return append(strings, text)
-							} else if !value.Valid && defaultValue.Bool {
-								return append(strings, fmt.Sprintf("%v (default)", text))
+						data.Length = policy.Length.Int64
+						if !policy.Length.Valid {
+							data.Length = defaultPolicy.Length.ValueOrZero()
+							data.Inherited = append(data.Inherited, "length")
+						}
+						data.Lowercase = resolveBool(policy.UseLowercase, defaultPolicy.UseLowercase, "lowercase")
+						data.Uppercase = resolveBool(policy.UseUppercase, defaultPolicy.UseUppercase, "uppercase")
+						data.Numbers = resolveBool(policy.UseNumbers, defaultPolicy.UseNumbers, "numbers")
+						data.Special = resolveBool(policy.UseSpecial, defaultPolicy.UseSpecial, "special")
+
+						// Text output marks the values that come from the default policy
+						describe := func(text, field string) string {
+							for _, inherited := range data.Inherited {
+								if inherited == field {
+									return fmt.Sprintf("%v (default)", text)
+								}
 							}
-
-							return strings
+							return text
 						}
 
-						useStrings := make([]string, 0, 4)
-						useStrings = appendUseString(useStrings, policy.UseLowercase, defaultPolicy.UseLowercase, "lowercase")
-						useStrings = appendUseString(useStrings, policy.UseUppercase, defaultPolicy.UseUppercase, "uppercase")
-						useStrings = appendUseString(useStrings, policy.UseNumbers, defaultPolicy.UseNumbers, "numbers")
-						useStrings = appendUseString(useStrings, policy.UseSpecial, defaultPolicy.UseSpecial, "special characters")
+						sLength := describe(fmt.Sprint(data.Length), "length")
 
+						useStrings := make([]string, 0, 4)
+						if data.Lowercase {
+							useStrings = append(useStrings, describe("lowercase", "lowercase"))
+						}
+						if data.Uppercase {
+							useStrings = append(useStrings, describe("uppercase", "uppercase"))
+						}
+						if data.Numbers {
+							useStrings = append(useStrings, describe("numbers", "numbers"))
+						}
+						if data.Special {
+							useStrings = append(useStrings, describe("special characters", "special"))
+						}
 						useString := strings.Join(useStrings, ", ")
 
-						settings.PrintFunc(fmt.Sprint("Length: ", sLength))
-						settings.PrintFunc(fmt.Sprint("Characters: ", useString))
-
-						return nil
+						return printData(settings, data, func() {
+							settings.PrintFunc(fmt.Sprint("Length: ", sLength))
+							settings.PrintFunc(fmt.Sprint("Characters: ", useString))
+						})
 					},
 				},
 				{
@@ -425,18 +532,14 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 					ArgsUsage: "<name>",
 					Aliases:   []string{"c"},
 					Action: func(c *cli.Context) error {
-						if c.NArg() < 1 {
-							return errors.New("Missing name argument")
-						}
-
-						entry, idx := db.GetEntry(c.Args().Get(0))
-						if idx == -1 {
-							return errors.New("Entry not found")
+						entry, err := findEntryToChange(c, db, settings)
+						if err != nil {
+							return err
 						}
 
 						policy := entry.PolicyOverride
 
-						settings.PrintFunc("Enter new policy values (leave blank to use default)")
+						printInstruction(settings, "Enter new policy values (leave blank to use default)")
 
 						policy.Length = promptInt("Length: ", settings)
 						policy.UseLowercase = promptBool("Use Lowercase [y/n]: ", settings)
@@ -445,12 +548,12 @@ func passwordCommands(db *passulib.PasswordDatabase, settings *PromptSettings) [
 						policy.UseSpecial = promptBool("Use Special characters [y/n]: ", settings)
 
 						entry.PolicyOverride = policy
-						err := db.UpdateEntry(entry.Name, entry)
+						err = db.UpdateEntry(entry.Name, entry)
 						if err != nil {
 							return err
 						}
 
-						settings.PrintFunc("Entry policy updated")
+						printMessage(settings, "Entry policy updated")
 						return nil
 					},
 				},
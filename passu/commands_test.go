@@ -1,10 +1,13 @@
 package passu_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/guregu/null"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/urfave/cli"
 	"github.com/winded/passu-lib"
 	"github.com/winded/passu/passu"
 	"strings"
@@ -556,7 +559,7 @@ var _ = Describe("CLI commands", func() {
 
 			Expect(err).To(BeNil())
 
-			err = passu.RunCommand([]string{"passwords", "delete", "test"}, db, &settings)
+			err = passu.RunCommand([]string{"passwords", "delete", "test", "--yes"}, db, &settings)
 
 			Expect(err).To(BeNil())
 
@@ -565,5 +568,647 @@ var _ = Describe("CLI commands", func() {
 			Expect(idx).To(Equal(-1))
 			Expect(strings.TrimSpace(output)).To(Equal("Entry removed"))
 		})
+		It("should ask for confirmation before deleting", func() {
+			pwInput := "testpassword"
+
+			db := passulib.NewPasswordDatabase(pwInput)
+
+			answer := "n"
+			settings := passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						if p == "Delete entry test? [y/n]: " {
+							return answer
+						}
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc:  func(text string) {},
+			}
+
+			err := db.AddEntry(passulib.PasswordEntry{
+				Name:        "test",
+				Password:    "mypassword",
+				Description: "description",
+			})
+
+			Expect(err).To(BeNil())
+
+			err = passu.RunCommand([]string{"passwords", "delete", "test"}, db, &settings)
+
+			Expect(err).NotTo(BeNil())
+			_, idx := db.GetEntry("test")
+			Expect(idx).NotTo(Equal(-1))
+
+			answer = "y"
+			err = passu.RunCommand([]string{"passwords", "delete", "test"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			_, idx = db.GetEntry("test")
+			Expect(idx).To(Equal(-1))
+		})
+	})
+
+	Context("Errors", func() {
+		It("should report missing entries", func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+
+			settings := passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc:  func(text string) {},
+			}
+
+			err := passu.RunCommand([]string{"passwords", "show", "missing"}, db, &settings)
+
+			Expect(err).To(Equal(passu.ErrEntryNotFound))
+			Expect(passu.ExitCode(err)).To(Equal(passu.ExitEntryNotFound))
+		})
+		It("should report missing arguments", func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+
+			settings := passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc:  func(text string) {},
+			}
+
+			err := passu.RunCommand([]string{"passwords", "show"}, db, &settings)
+
+			Expect(errors.Is(err, passu.ErrMissingArgument)).To(BeTrue())
+			Expect(err.Error()).To(Equal("Missing name argument"))
+			Expect(passu.ExitCode(err)).To(Equal(passu.ExitMissingArgument))
+		})
+		It("should refuse to exit with unsaved changes", func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{
+				Name:     "test",
+				Password: "test",
+			})
+
+			exited := false
+			settings := passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc:  func(text string) {},
+				ExitFunc: func() {
+					exited = true
+				},
+			}
+
+			err := passu.RunCommand([]string{"exit"}, db, &settings)
+
+			Expect(errors.Is(err, passu.ErrUnsavedChanges)).To(BeTrue())
+			Expect(exited).To(BeFalse())
+
+			err = passu.RunCommand([]string{"exit", "-f"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(exited).To(BeTrue())
+		})
+	})
+
+	Context("Output formats", func() {
+		var db *passulib.PasswordDatabase
+		var output string
+		var settings passu.PromptSettings
+
+		BeforeEach(func() {
+			db = passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{
+				Name:        "test",
+				Password:    "mypassword",
+				Description: "description",
+				PolicyOverride: passulib.PasswordPolicy{
+					Length:       null.IntFrom(12),
+					UseLowercase: null.BoolFrom(false),
+				},
+			})
+
+			output = ""
+			settings = passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				Format:     passu.FormatJSON,
+				PrintFunc: func(text string) {
+					output += text + "\n"
+				},
+			}
+		})
+
+		It("should list passwords as JSON", func() {
+			err := passu.RunCommand([]string{"passwords", "list"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(output).To(MatchJSON(`[{"name": "test"}]`))
+		})
+		It("should show password entry as JSON", func() {
+			err := passu.RunCommand([]string{"passwords", "show", "test"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(output).To(MatchJSON(`{"name": "test", "password_length": 10, "description": "description"}`))
+		})
+		It("should show password entry policy as JSON", func() {
+			err := passu.RunCommand([]string{"passwords", "policy", "view", "test"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(output).To(MatchJSON(`{"length": 12, "lowercase": false, "uppercase": true, "numbers": true, "special": true, "inherited": ["uppercase", "numbers", "special"]}`))
+		})
+		It("should keep prompt instructions out of structured output", func() {
+			err := passu.RunCommand([]string{"passwords", "policy", "change", "test"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(output).To(MatchJSON(`{"message": "Entry policy updated"}`))
+		})
+		It("should show password entry as YAML", func() {
+			settings.Format = passu.FormatYAML
+			err := passu.RunCommand([]string{"passwords", "show", "test"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(output).To(MatchYAML("name: test\npassword_length: 10\ndescription: description\n"))
+		})
+	})
+
+	Context("Undo/Redo", func() {
+		It("should undo and redo changes", func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{
+				Name:        "test",
+				Password:    "mypassword",
+				Description: "description",
+			})
+
+			output := ""
+			settings := passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText:     "test> ",
+				MasterPassword: "testpassword",
+				PrintFunc: func(text string) {
+					output += text + "\n"
+				},
+			}
+
+			err := passu.RunCommand([]string{"status"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("No unsaved changes"))
+
+			err = passu.RunCommand([]string{"passwords", "edit", "test", "--new-name", "test2"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			output = ""
+			err = passu.RunCommand([]string{"status"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("> test -> test2"))
+
+			err = passu.RunCommand([]string{"undo"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("test")
+			Expect(idx).NotTo(Equal(-1))
+			Expect(db.Modified).To(BeFalse())
+
+			err = passu.RunCommand([]string{"redo"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx = db.GetEntry("test2")
+			Expect(idx).NotTo(Equal(-1))
+			Expect(db.Modified).To(BeTrue())
+
+			err = passu.RunCommand([]string{"redo"}, db, &settings)
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Context("Folders", func() {
+		var db *passulib.PasswordDatabase
+		var output string
+		var settings passu.PromptSettings
+
+		BeforeEach(func() {
+			db = passulib.NewPasswordDatabase("testpassword")
+			for _, name := range []string{"work/aws/prod-root", "work/aws/staging", "work/mail", "bank"} {
+				db.AddEntry(passulib.PasswordEntry{
+					Name:     name,
+					Password: "mypassword",
+				})
+			}
+
+			output = ""
+			settings = passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc: func(text string) {
+					output += text + "\n"
+				},
+			}
+		})
+
+		It("should list passwords as a tree", func() {
+			err := passu.RunCommand([]string{"passwords", "list", "--tree"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("bank\nwork/\n  aws/\n    prod-root\n    staging\n  mail"))
+		})
+		It("should resolve names relative to the current folder", func() {
+			err := passu.RunCommand([]string{"cd", "work"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			err = passu.RunCommand([]string{"pwd"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("/work"))
+
+			output = ""
+			err = passu.RunCommand([]string{"passwords", "list"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("aws/prod-root\naws/staging\nmail"))
+
+			output = ""
+			err = passu.RunCommand([]string{"passwords", "show", "-p", "aws/staging"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("mypassword"))
+
+			output = ""
+			err = passu.RunCommand([]string{"passwords", "show", "-p", "../bank"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("mypassword"))
+
+			err = passu.RunCommand([]string{"cd", "missing"}, db, &settings)
+			Expect(err).NotTo(BeNil())
+		})
+		It("should move a folder", func() {
+			err := passu.RunCommand([]string{"passwords", "mv", "work/aws", "cloud/"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("cloud/aws/prod-root")
+			Expect(idx).NotTo(Equal(-1))
+			_, idx = db.GetEntry("cloud/aws/staging")
+			Expect(idx).NotTo(Equal(-1))
+			_, idx = db.GetEntry("work/aws/staging")
+			Expect(idx).To(Equal(-1))
+		})
+		It("should move a folder into itself", func() {
+			db.AddEntry(passulib.PasswordEntry{Name: "f/a", Password: "outer"})
+			db.AddEntry(passulib.PasswordEntry{Name: "f/f/a", Password: "inner"})
+
+			err := passu.RunCommand([]string{"passwords", "mv", "f", "f/f"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			entry, _ := db.GetEntry("f/f/a")
+			Expect(entry.Password).To(Equal("outer"))
+			entry, _ = db.GetEntry("f/f/f/a")
+			Expect(entry.Password).To(Equal("inner"))
+			_, idx := db.GetEntry("f/a")
+			Expect(idx).To(Equal(-1))
+		})
+		It("should keep names that look like paths", func() {
+			err := passu.RunCommand([]string{"passwords", "new", "https://github.com"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("https://github.com")
+			Expect(idx).NotTo(Equal(-1))
+
+			db.AddEntry(passulib.PasswordEntry{Name: "old/./entry/", Password: "mypassword"})
+			err = passu.RunCommand([]string{"passwords", "delete", "--yes", "old/./entry/"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx = db.GetEntry("old/./entry/")
+			Expect(idx).To(Equal(-1))
+		})
+		It("should prefer entries in the current folder", func() {
+			db.AddEntry(passulib.PasswordEntry{Name: "mail", Password: "rootpassword"})
+			db.AddEntry(passulib.PasswordEntry{Name: "work/https://github.com", Password: "githubpassword"})
+
+			err := passu.RunCommand([]string{"cd", "work"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			err = passu.RunCommand([]string{"passwords", "show", "-p", "mail"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("mypassword"))
+
+			output = ""
+			err = passu.RunCommand([]string{"passwords", "show", "-p", "https://github.com"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("githubpassword"))
+
+			err = passu.RunCommand([]string{"passwords", "delete", "--yes", "mail"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("work/mail")
+			Expect(idx).To(Equal(-1))
+			_, idx = db.GetEntry("mail")
+			Expect(idx).NotTo(Equal(-1))
+		})
+		It("should move an entry into a folder", func() {
+			err := passu.RunCommand([]string{"passwords", "mv", "bank", "personal/"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("personal/bank")
+			Expect(idx).NotTo(Equal(-1))
+		})
+	})
+
+	Context("Search", func() {
+		var db *passulib.PasswordDatabase
+		var output string
+		var settings passu.PromptSettings
+
+		BeforeEach(func() {
+			db = passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{Name: "github", Password: "mypassword"})
+			db.AddEntry(passulib.PasswordEntry{Name: "work/github-enterprise", Password: "mypassword"})
+			db.AddEntry(passulib.PasswordEntry{Name: "mail", Password: "mypassword", Description: "GitHub notifications"})
+
+			output = ""
+			settings = passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc: func(text string) {
+					output += text + "\n"
+				},
+			}
+		})
+
+		It("should rank name matches before description matches", func() {
+			err := passu.RunCommand([]string{"passwords", "search", "GitHub"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("github\nwork/github-enterprise\nmail (GitHub notifications)"))
+		})
+		It("should search with fuzzy matching", func() {
+			err := passu.RunCommand([]string{"passwords", "search", "--fuzzy", "githb"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("github\nwork/github-enterprise"))
+		})
+		It("should search with a regular expression", func() {
+			err := passu.RunCommand([]string{"passwords", "search", "--regex", "^(mail|github)$"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("github\nmail"))
+		})
+		It("should suggest the closest entries when an entry is not found", func() {
+			err := passu.RunCommand([]string{"passwords", "delete", "--yes", "githb"}, db, &settings)
+
+			Expect(err).To(MatchError("Entry not found. Did you mean: github, work/github-enterprise?"))
+			Expect(passu.ExitCode(err)).To(Equal(passu.ExitEntryNotFound))
+		})
+	})
+
+	Context("Name resolution", func() {
+		var db *passulib.PasswordDatabase
+		var output string
+		var instructions string
+		var answer string
+		var settings passu.PromptSettings
+
+		BeforeEach(func() {
+			db = passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{Name: "github", Password: "githubpassword"})
+			db.AddEntry(passulib.PasswordEntry{Name: "gitlab", Password: "gitlabpassword"})
+			db.AddEntry(passulib.PasswordEntry{Name: "mail", Password: "mailpassword"})
+
+			output = ""
+			instructions = ""
+			answer = ""
+			settings = passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return answer
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc: func(text string) {
+					output += text + "\n"
+				},
+				InstructFunc: func(text string) {
+					instructions += text + "\n"
+				},
+			}
+		})
+
+		It("should resolve a unique prefix", func() {
+			err := passu.RunCommand([]string{"passwords", "show", "-p", "GITL"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("gitlabpassword"))
+		})
+		It("should resolve a fuzzy match", func() {
+			err := passu.RunCommand([]string{"passwords", "show", "-p", "mial"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("mailpassword"))
+		})
+		It("should report ambiguous names in single commands", func() {
+			err := passu.RunCommand([]string{"passwords", "show", "-p", "git"}, db, &settings)
+
+			Expect(err).To(MatchError("Entry name git is ambiguous. Matching entries: github, gitlab"))
+			Expect(passu.ExitCode(err)).To(Equal(passu.ExitAmbiguousEntry))
+		})
+		It("should let the user pick an entry in the prompt", func() {
+			settings.Interactive = true
+			answer = "2"
+			err := passu.RunCommand([]string{"passwords", "show", "-p", "git"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("gitlabpassword"))
+			Expect(instructions).To(Equal("Several entries match git:\n1) github\n2) gitlab\n"))
+		})
+		It("should report names that only differ by case as ambiguous", func() {
+			db.AddEntry(passulib.PasswordEntry{Name: "GitHub", Password: "otherpassword"})
+			err := passu.RunCommand([]string{"passwords", "show", "-p", "GITHUB"}, db, &settings)
+
+			Expect(err).To(MatchError("Entry name GITHUB is ambiguous. Matching entries: GitHub, github"))
+		})
+		It("should say when the list of matching entries is cut short", func() {
+			for idx := 1; idx <= 12; idx++ {
+				db.AddEntry(passulib.PasswordEntry{Name: fmt.Sprintf("site%02d", idx), Password: "sitepassword"})
+			}
+
+			settings.Interactive = true
+			answer = "10"
+			err := passu.RunCommand([]string{"passwords", "show", "-p", "site"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("sitepassword"))
+			Expect(instructions).To(ContainSubstring("Showing the first 10 of 12 matches"))
+			Expect(instructions).To(ContainSubstring("10) site10\n"))
+			Expect(instructions).NotTo(ContainSubstring("site11"))
+		})
+		It("should not print parse errors of prompt answers as output", func() {
+			settings.Interactive = true
+			answer = "second"
+			err := passu.RunCommand([]string{"passwords", "show", "-p", "git"}, db, &settings)
+
+			Expect(err).To(MatchError("No entry selected"))
+			Expect(output).To(Equal(""))
+			Expect(instructions).To(HaveSuffix("Could not parse value. Using default\n"))
+		})
+		It("should only edit exact names in single commands", func() {
+			err := passu.RunCommand([]string{"passwords", "edit", "-d", "changed", "mai"}, db, &settings)
+			Expect(errors.Is(err, passu.ErrEntryNotFound)).To(BeTrue())
+
+			entry, _ := db.GetEntry("mail")
+			Expect(entry.Description).To(Equal(""))
+		})
+		It("should ask before editing an entry that doesn't match exactly", func() {
+			settings.Interactive = true
+
+			answer = "n"
+			err := passu.RunCommand([]string{"passwords", "edit", "-d", "changed", "mai"}, db, &settings)
+			Expect(err).To(MatchError("Change cancelled"))
+
+			answer = "y"
+			err = passu.RunCommand([]string{"passwords", "edit", "-d", "changed", "mai"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			entry, _ := db.GetEntry("mail")
+			Expect(entry.Description).To(Equal("changed"))
+		})
+		It("should only delete exact names without confirmation", func() {
+			err := passu.RunCommand([]string{"passwords", "delete", "--yes", "gitl"}, db, &settings)
+			Expect(err).NotTo(BeNil())
+
+			answer = "y"
+			err = passu.RunCommand([]string{"passwords", "delete", "gitl"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("gitlab")
+			Expect(idx).To(Equal(-1))
+		})
+	})
+
+	Context("Completion", func() {
+		var completer *passu.Completer
+		var settings passu.PromptSettings
+
+		complete := func(line string) []string {
+			suffixes, _ := completer.Do([]rune(line), len([]rune(line)))
+			result := make([]string, len(suffixes))
+			for idx, suffix := range suffixes {
+				result[idx] = string(suffix)
+			}
+			return result
+		}
+
+		BeforeEach(func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+			for _, name := range []string{"work/aws/prod-root", "work/mail", "bank"} {
+				db.AddEntry(passulib.PasswordEntry{
+					Name:     name,
+					Password: "mypassword",
+				})
+			}
+
+			settings = passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc:  func(text string) {},
+			}
+			completer = passu.NewCompleter(db, &settings)
+		})
+
+		It("should complete commands and aliases", func() {
+			Expect(complete("pass")).To(Equal([]string{"words "}))
+			Expect(complete("pw sh")).To(Equal([]string{"ow "}))
+			Expect(complete("dp v")).To(Equal([]string{" ", "iew "}))
+		})
+		It("should complete flags", func() {
+			Expect(complete("pw show -")).To(Equal([]string{"-pass-only ", "p "}))
+		})
+		It("should complete entry names", func() {
+			Expect(complete("pw cp ")).To(Equal([]string{"bank ", "work/"}))
+			Expect(complete("pw cp work/")).To(Equal([]string{"aws/", "mail "}))
+			Expect(complete("cd ")).To(Equal([]string{"work/"}))
+			Expect(complete("pw edit --new-name ")).To(BeEmpty())
+		})
+		It("should complete entry names relative to the current folder", func() {
+			settings.CurrentFolder = "work"
+
+			Expect(complete("pw show ")).To(Equal([]string{"aws/", "mail "}))
+			Expect(complete("pw show ../b")).To(Equal([]string{"ank "}))
+		})
+	})
+
+	Context("Shell completion", func() {
+		var app *cli.App
+
+		BeforeEach(func() {
+			app = cli.NewApp()
+			app.Name = "passu"
+			app.Flags = []cli.Flag{
+				cli.StringFlag{Name: "format"},
+				cli.BoolFlag{Name: "auto-reload"},
+			}
+			app.Commands = []cli.Command{
+				{Name: "completion", ArgsUsage: "bash|zsh|fish"},
+			}
+		})
+
+		It("should write a bash completion script", func() {
+			script := &bytes.Buffer{}
+			err := passu.WriteCompletionScript(script, "bash", app)
+
+			Expect(err).To(BeNil())
+			Expect(script.String()).To(ContainSubstring("complete -F _passu passu"))
+			Expect(script.String()).To(ContainSubstring(`words="--format --auto-reload completion"`))
+			Expect(script.String()).To(ContainSubstring("\"+completion\")\n\t\t\twords=\"bash zsh fish\""))
+			Expect(script.String()).To(ContainSubstring("\"passwords show\" | \"passwords s\" | \"pw show\" | \"pw s\")\n\t\t\twords=\"--pass-only -p\""))
+		})
+		It("should write a fish completion script", func() {
+			script := &bytes.Buffer{}
+			err := passu.WriteCompletionScript(script, "fish", app)
+
+			Expect(err).To(BeNil())
+			Expect(script.String()).To(ContainSubstring("complete -c passu -f -a '(__passu_complete)'"))
+			Expect(script.String()).To(ContainSubstring("case 'passwords show' 'passwords s' 'pw show' 'pw s'\n\t\t\tprintf '%s\\n' --pass-only -p"))
+		})
+		It("should reject unknown shells", func() {
+			err := passu.WriteCompletionScript(&bytes.Buffer{}, "tcsh", app)
+
+			Expect(err).NotTo(BeNil())
+		})
 	})
 })
@@ -0,0 +1,207 @@
+package passu
+
+import (
+	"github.com/kballard/go-shellquote"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+	"sort"
+	"strings"
+)
+
+// Completer completes commands, flags and entry names in the interactive prompt.
+// It implements readline.AutoCompleter.
+type Completer struct {
+	db       *passulib.PasswordDatabase
+	settings *PromptSettings
+	commands []cli.Command
+}
+
+func NewCompleter(db *passulib.PasswordDatabase, settings *PromptSettings) *Completer {
+	return &Completer{
+		db:       db,
+		settings: settings,
+		commands: append(commands(db, settings), cli.Command{Name: "help", Aliases: []string{"h"}}),
+	}
+}
+
+// Do returns the possible endings of the word under the cursor, and the length of the part already typed.
+func (cm *Completer) Do(line []rune, pos int) ([][]rune, int) {
+	input := string(line[:pos])
+	words, err := shellquote.Split(input)
+	if err != nil {
+		return nil, 0
+	}
+
+	// The raw text of the word being completed, which may contain escapes
+	typed := input[strings.LastIndexAny(input, " \t")+1:]
+	current := ""
+	if typed != "" && len(words) > 0 {
+		current = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	candidates := cm.candidates(words, current)
+	sort.Strings(candidates)
+
+	result := make([][]rune, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !strings.HasPrefix(candidate, current) {
+			continue
+		}
+
+		suffix := strings.Replace(strings.TrimPrefix(candidate, current), " ", "\\ ", -1)
+		if !strings.HasSuffix(candidate, "/") {
+			suffix += " "
+		}
+		result = append(result, []rune(suffix))
+	}
+	return result, len([]rune(typed))
+}
+
+// candidates returns the words that can follow words, the complete words before the cursor.
+func (cm *Completer) candidates(words []string, current string) []string {
+	var command *cli.Command
+	subcommands := cm.commands
+	args := 0
+	skipValue := false
+
+	for _, word := range words {
+		if skipValue {
+			skipValue = false
+			continue
+		}
+
+		if strings.HasPrefix(word, "-") {
+			if command != nil && !strings.Contains(word, "=") {
+				skipValue = flagTakesValue(command.Flags, strings.TrimLeft(word, "-"))
+			}
+			continue
+		}
+
+		if len(subcommands) > 0 {
+			next := findCommand(subcommands, word)
+			if next == nil {
+				return nil
+			}
+			command = next
+			subcommands = next.Subcommands
+			continue
+		}
+		args++
+	}
+
+	if skipValue {
+		return nil
+	}
+	if strings.HasPrefix(current, "-") {
+		if command == nil {
+			return nil
+		}
+		return flagNames(command.Flags)
+	}
+	if len(subcommands) > 0 {
+		return commandNames(subcommands, current != "")
+	}
+	if command == nil {
+		return nil
+	}
+
+	argNames := strings.Fields(command.ArgsUsage)
+	if args >= len(argNames) {
+		return nil
+	}
+	switch argNames[args] {
+	case "<name>", "<source>", "<destination>":
+		return cm.entryNames(current, false)
+	case "[folder]":
+		return cm.entryNames(current, true)
+	default:
+		return nil
+	}
+}
+
+// entryNames returns the entries and folders in the folder of current, with the folder part of current as prefix.
+// Folders end with "/". If foldersOnly is set, only folders are returned.
+func (cm *Completer) entryNames(current string, foldersOnly bool) []string {
+	dir := current[:strings.LastIndex(current, "/")+1]
+	folder := strings.TrimSuffix(resolveName(dir, cm.settings), "/")
+	if dir == "" {
+		folder = cm.settings.CurrentFolder
+	}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, entry := range entriesInFolder(cm.db, folder) {
+		name := strings.TrimPrefix(entry.Name, folder+"/")
+		if folder == "" {
+			name = entry.Name
+		}
+
+		if idx := strings.Index(name, "/"); idx != -1 {
+			name = name[:idx+1]
+		} else if foldersOnly {
+			continue
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, dir+name)
+		}
+	}
+	return names
+}
+
+func findCommand(commands []cli.Command, name string) *cli.Command {
+	for idx := range commands {
+		if commands[idx].HasName(name) {
+			return &commands[idx]
+		}
+	}
+	return nil
+}
+
+// commandNames returns the names of commands, and their aliases too if withAliases is set.
+func commandNames(commands []cli.Command, withAliases bool) []string {
+	names := make([]string, 0, len(commands))
+	for _, command := range commands {
+		if withAliases {
+			names = append(names, command.Names()...)
+		} else {
+			names = append(names, command.Name)
+		}
+	}
+	return names
+}
+
+func flagNames(flags []cli.Flag) []string {
+	names := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		for _, name := range strings.Split(flag.GetName(), ",") {
+			name = strings.TrimSpace(name)
+			if len(name) == 1 {
+				names = append(names, "-"+name)
+			} else {
+				names = append(names, "--"+name)
+			}
+		}
+	}
+	return names
+}
+
+func flagTakesValue(flags []cli.Flag, name string) bool {
+	for _, flag := range flags {
+		for _, flagName := range strings.Split(flag.GetName(), ",") {
+			if strings.TrimSpace(flagName) != name {
+				continue
+			}
+
+			switch flag.(type) {
+			case cli.BoolFlag, cli.BoolTFlag:
+				return false
+			default:
+				return true
+			}
+		}
+	}
+	return false
+}
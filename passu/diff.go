@@ -0,0 +1,260 @@
+package passu
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+	"sort"
+	"strings"
+)
+
+type entryChange struct {
+	Name   string
+	Kind   string
+	From   passulib.PasswordEntry
+	To     passulib.PasswordEntry
+	Fields []string
+}
+
+// diffEntries returns the changes needed to turn the entries in from into the entries in to, sorted by name.
+// A removed entry and an added entry that differ only by name are reported as a rename,
+// unless their password is shared with another added or removed entry.
+func diffEntries(from, to []passulib.PasswordEntry) []entryChange {
+	fromMap := make(map[string]passulib.PasswordEntry, len(from))
+	for _, entry := range from {
+		fromMap[entry.Name] = entry
+	}
+	toMap := make(map[string]passulib.PasswordEntry, len(to))
+	for _, entry := range to {
+		toMap[entry.Name] = entry
+	}
+
+	changes := make([]entryChange, 0)
+	removed := make([]passulib.PasswordEntry, 0)
+	for _, fromEntry := range from {
+		toEntry, ok := toMap[fromEntry.Name]
+		if !ok {
+			removed = append(removed, fromEntry)
+			continue
+		}
+
+		fields := changedFields(fromEntry, toEntry)
+		if len(fields) > 0 {
+			changes = append(changes, entryChange{Name: fromEntry.Name, Kind: "changed", From: fromEntry, To: toEntry, Fields: fields})
+		}
+	}
+
+	added := make([]passulib.PasswordEntry, 0)
+	for _, toEntry := range to {
+		if _, ok := fromMap[toEntry.Name]; !ok {
+			added = append(added, toEntry)
+		}
+	}
+
+	// A removed and an added entry are only paired if they have the same non-empty password, description
+	// and policy, and no other added or removed entry has that password, so reused passwords don't show up as renames.
+	passwordCount := make(map[string]int)
+	for _, entry := range append(append([]passulib.PasswordEntry{}, removed...), added...) {
+		passwordCount[entry.Password]++
+	}
+	renamedTo := make(map[string]bool)
+	for _, fromEntry := range removed {
+		var match *passulib.PasswordEntry
+		if fromEntry.Password != "" && passwordCount[fromEntry.Password] == 2 {
+			for idx := range added {
+				if len(changedFields(fromEntry, added[idx])) == 0 {
+					match = &added[idx]
+				}
+			}
+		}
+
+		if match != nil {
+			changes = append(changes, entryChange{Name: match.Name, Kind: "renamed", From: fromEntry, To: *match})
+			renamedTo[match.Name] = true
+		} else {
+			changes = append(changes, entryChange{Name: fromEntry.Name, Kind: "removed", From: fromEntry})
+		}
+	}
+	for _, toEntry := range added {
+		if !renamedTo[toEntry.Name] {
+			changes = append(changes, entryChange{Name: toEntry.Name, Kind: "added", To: toEntry})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func changedFields(a, b passulib.PasswordEntry) []string {
+	fields := make([]string, 0, 3)
+	if a.Password != b.Password {
+		fields = append(fields, "password")
+	}
+	if a.Description != b.Description {
+		fields = append(fields, "description")
+	}
+	if a.PolicyOverride != b.PolicyOverride {
+		fields = append(fields, "policy")
+	}
+	return fields
+}
+
+// formatPolicy describes the values set in a policy. Values that are not set are left out.
+func formatPolicy(policy passulib.PasswordPolicy) string {
+	values := make([]string, 0, 5)
+	if policy.Length.Valid {
+		values = append(values, fmt.Sprintf("length %v", policy.Length.Int64))
+	}
+
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	if policy.UseLowercase.Valid {
+		values = append(values, fmt.Sprintf("lowercase %v", yesNo[policy.UseLowercase.Bool]))
+	}
+	if policy.UseUppercase.Valid {
+		values = append(values, fmt.Sprintf("uppercase %v", yesNo[policy.UseUppercase.Bool]))
+	}
+	if policy.UseNumbers.Valid {
+		values = append(values, fmt.Sprintf("numbers %v", yesNo[policy.UseNumbers.Bool]))
+	}
+	if policy.UseSpecial.Valid {
+		values = append(values, fmt.Sprintf("special characters %v", yesNo[policy.UseSpecial.Bool]))
+	}
+
+	if len(values) == 0 {
+		return "default"
+	}
+	return strings.Join(values, ", ")
+}
+
+func printChanges(changes []entryChange, reveal bool, settings *PromptSettings) {
+	for _, change := range changes {
+		switch change.Kind {
+		case "added":
+			settings.PrintFunc(fmt.Sprintf("+ %v", change.Name))
+		case "removed":
+			settings.PrintFunc(fmt.Sprintf("- %v", change.Name))
+		case "renamed":
+			settings.PrintFunc(fmt.Sprintf("> %v -> %v", change.From.Name, change.To.Name))
+		case "changed":
+			settings.PrintFunc(fmt.Sprintf("~ %v", change.Name))
+		}
+
+		for _, field := range changeFieldOutputs(change, reveal) {
+			switch {
+			case field.Field == "password" && !reveal:
+				settings.PrintFunc("    password: changed")
+			case field.Field == "description":
+				settings.PrintFunc(fmt.Sprintf("    description: %q -> %q", field.From, field.To))
+			default:
+				settings.PrintFunc(fmt.Sprintf("    %v: %v -> %v", field.Field, field.From, field.To))
+			}
+		}
+	}
+}
+
+// changeFieldOutputs returns the old and new values of the changed fields. Passwords are left out unless reveal is set.
+func changeFieldOutputs(change entryChange, reveal bool) []fieldChangeOutput {
+	fields := make([]fieldChangeOutput, 0, len(change.Fields))
+	for _, field := range change.Fields {
+		switch field {
+		case "password":
+			if reveal {
+				fields = append(fields, fieldChangeOutput{Field: field, From: change.From.Password, To: change.To.Password})
+			} else {
+				fields = append(fields, fieldChangeOutput{Field: field})
+			}
+		case "description":
+			fields = append(fields, fieldChangeOutput{Field: field, From: change.From.Description, To: change.To.Description})
+		case "policy":
+			fields = append(fields, fieldChangeOutput{Field: field, From: formatPolicy(change.From.PolicyOverride), To: formatPolicy(change.To.PolicyOverride)})
+		}
+	}
+	return fields
+}
+
+func printDatabaseDiff(from, to *passulib.PasswordDatabase, reveal bool, settings *PromptSettings) error {
+	return printSnapshotDiff(databaseSnapshot(from), databaseSnapshot(to), reveal, settings)
+}
+
+func printSnapshotDiff(from, to snapshot, reveal bool, settings *PromptSettings) error {
+	changes := diffEntries(from.Entries, to.Entries)
+
+	data := diffOutput{Changes: make([]changeOutput, len(changes))}
+	for idx, change := range changes {
+		data.Changes[idx] = changeOutput{
+			Name:   change.Name,
+			Kind:   change.Kind,
+			Fields: changeFieldOutputs(change, reveal),
+		}
+		if change.Kind == "renamed" {
+			data.Changes[idx].OldName = change.From.Name
+		}
+	}
+
+	if from.DefaultPolicy != to.DefaultPolicy {
+		data.DefaultPolicy = &fieldChangeOutput{Field: "default_policy", From: formatPolicy(from.DefaultPolicy), To: formatPolicy(to.DefaultPolicy)}
+	}
+	data.MasterPasswordChanged = from.Password != to.Password
+
+	return printData(settings, data, func() {
+		printChanges(changes, reveal, settings)
+
+		if data.DefaultPolicy != nil {
+			settings.PrintFunc(fmt.Sprintf("~ default policy: %v -> %v", data.DefaultPolicy.From, data.DefaultPolicy.To))
+		}
+		if data.MasterPasswordChanged {
+			settings.PrintFunc("~ master password")
+		}
+		if len(changes) == 0 && data.DefaultPolicy == nil && !data.MasterPasswordChanged {
+			settings.PrintFunc("No differences")
+		}
+	})
+}
+
+// DiffFiles prints the differences between two database files.
+func DiffFiles(fromPath, toPath string, reveal bool, settings *PromptSettings) error {
+	password, err := ReadMasterPassword("Master password: ", settings)
+	if err != nil {
+		return err
+	}
+	settings.MasterPassword = password
+
+	from, _, err := openDatabaseFile(fromPath, settings)
+	if err != nil {
+		return err
+	}
+	to, _, err := openDatabaseFile(toPath, settings)
+	if err != nil {
+		return err
+	}
+
+	return printDatabaseDiff(from, to, reveal, settings)
+}
+
+func diffCommand(db *passulib.PasswordDatabase, settings *PromptSettings) cli.Command {
+	return cli.Command{
+		Name:      "diff",
+		Usage:     "Show differences between the open database and a database file",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "reveal, r",
+				Usage: "Show changed passwords",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return missingArgument("file")
+			}
+
+			other, _, err := openDatabaseFile(c.Args().Get(0), settings)
+			if err != nil {
+				return err
+			}
+
+			return printDatabaseDiff(db, other, c.Bool("reveal"), settings)
+		},
+	}
+}
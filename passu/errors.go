@@ -0,0 +1,110 @@
+package passu
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/winded/passu-lib"
+	"io"
+)
+
+var (
+	ErrWrongPassword   = errors.New("Wrong master password")
+	ErrCorruptFile     = errors.New("Password file is damaged or in an unsupported format")
+	ErrEntryNotFound   = errors.New("Entry not found")
+	ErrMissingArgument = errors.New("Missing argument")
+	ErrUnsavedChanges  = errors.New("Unsaved changes")
+	ErrLocked          = errors.New("Database is locked")
+	ErrReadOnly        = errors.New("Database is opened read-only")
+	ErrMergeConflict   = errors.New("Unresolved merge conflict")
+	ErrAmbiguousEntry  = errors.New("Entry name is ambiguous")
+)
+
+// Exit codes of the passu command. ExitCode maps errors to these.
+const (
+	ExitOK              = 0
+	ExitError           = 1 // Any error without a more specific code
+	ExitWrongPassword   = 2
+	ExitCorruptFile     = 3
+	ExitEntryNotFound   = 4
+	ExitMissingArgument = 5
+	ExitUnsavedChanges  = 6
+	ExitLocked          = 7
+	ExitReadOnly        = 8
+	ExitMergeConflict   = 9
+	ExitAmbiguousEntry  = 10
+)
+
+// ExitCode returns the exit code of the passu command for an error returned by a command.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrWrongPassword):
+		return ExitWrongPassword
+	case errors.Is(err, ErrCorruptFile):
+		return ExitCorruptFile
+	case errors.Is(err, ErrEntryNotFound):
+		return ExitEntryNotFound
+	case errors.Is(err, ErrMissingArgument):
+		return ExitMissingArgument
+	case errors.Is(err, ErrUnsavedChanges):
+		return ExitUnsavedChanges
+	case errors.Is(err, ErrLocked):
+		return ExitLocked
+	case errors.Is(err, ErrReadOnly):
+		return ExitReadOnly
+	case errors.Is(err, ErrMergeConflict):
+		return ExitMergeConflict
+	case errors.Is(err, ErrAmbiguousEntry):
+		return ExitAmbiguousEntry
+	default:
+		return ExitError
+	}
+}
+
+type missingArgumentError struct {
+	name string
+}
+
+func (e *missingArgumentError) Error() string {
+	return fmt.Sprintf("Missing %v argument", e.name)
+}
+
+func (e *missingArgumentError) Is(target error) bool {
+	return target == ErrMissingArgument
+}
+
+// missingArgument returns an error matching ErrMissingArgument that names the missing argument.
+func missingArgument(name string) error {
+	return &missingArgumentError{name: name}
+}
+
+// OpenDatabase decrypts database data like passulib.PasswordDatabaseFromData,
+// but reports failures as ErrWrongPassword or ErrCorruptFile.
+// Errors that show the data itself is malformed count as a damaged file, anything else as a wrong password.
+func OpenDatabase(data []byte, password string) (*passulib.PasswordDatabase, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrCorruptFile)
+	}
+
+	db, err := passulib.PasswordDatabaseFromData(data, password)
+	if err == nil {
+		return db, nil
+	}
+
+	if malformedDataError(err) {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptFile, err)
+	}
+	return nil, ErrWrongPassword
+}
+
+// malformedDataError reports whether err shows that database data could not be decoded at all,
+// as opposed to failing to decrypt. Only the error types of the decoders are checked, never error messages.
+func malformedDataError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var base64Err base64.CorruptInputError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &base64Err) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,84 @@
+package passu
+
+import (
+	"fmt"
+	"github.com/winded/passu-lib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces the database file at filePath with data.
+// The data is written to a temporary file in the same directory, synced to disk
+// and verified to open with the given master password before it is renamed over the original,
+// so an interrupted save never leaves a truncated database behind. If filePath is a symlink, the file it points to is replaced.
+func WriteFileAtomic(filePath string, data []byte, password string) error {
+	// Replace the target of a symlink rather than the link itself
+	if resolved, err := filepath.EvalSymlinks(filePath); err == nil {
+		filePath = resolved
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	if stat, err := os.Stat(filePath); err == nil {
+		mode = stat.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(filePath)
+	tmp, err := ioutil.TempFile(dir, fmt.Sprintf(".%v.tmp", filepath.Base(filePath)))
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	success := false
+	defer func() {
+		if !success {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(mode)
+	if err != nil {
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	written, err := ioutil.ReadFile(tmpName)
+	if err != nil {
+		return err
+	}
+	_, err = passulib.PasswordDatabaseFromData(written, password)
+	if err != nil {
+		return fmt.Errorf("Saved data could not be verified, original file left untouched: %v", err)
+	}
+
+	err = os.Rename(tmpName, filePath)
+	if err != nil {
+		return err
+	}
+	success = true
+
+	// Sync the directory so the rename itself survives a crash. Not all platforms support this.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
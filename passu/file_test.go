@@ -0,0 +1,530 @@
+package passu_test
+
+import (
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/winded/passu-lib"
+	"github.com/winded/passu/passu"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Describe("File operations", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "passu-test")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("Atomic write", func() {
+		It("should replace the file and keep its mode", func() {
+			filePath := filepath.Join(dir, "test.passu")
+			err := ioutil.WriteFile(filePath, []byte("old data"), 0640)
+			Expect(err).To(BeNil())
+
+			db := passulib.NewPasswordDatabase("testpassword")
+			err = passu.WriteFileAtomic(filePath, db.Save(), "testpassword")
+			Expect(err).To(BeNil())
+
+			data, err := ioutil.ReadFile(filePath)
+			Expect(err).To(BeNil())
+			_, err = passulib.PasswordDatabaseFromData(data, "testpassword")
+			Expect(err).To(BeNil())
+
+			stat, err := os.Stat(filePath)
+			Expect(err).To(BeNil())
+			Expect(stat.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+			files, err := ioutil.ReadDir(dir)
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+		})
+		It("should leave the original file untouched if verification fails", func() {
+			filePath := filepath.Join(dir, "test.passu")
+			err := ioutil.WriteFile(filePath, []byte("old data"), 0600)
+			Expect(err).To(BeNil())
+
+			db := passulib.NewPasswordDatabase("testpassword")
+			err = passu.WriteFileAtomic(filePath, db.Save(), "wrongpassword")
+			Expect(err).NotTo(BeNil())
+
+			data, err := ioutil.ReadFile(filePath)
+			Expect(err).To(BeNil())
+			Expect(string(data)).To(Equal("old data"))
+
+			files, err := ioutil.ReadDir(dir)
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+		})
+		It("should replace the target of a symlink", func() {
+			targetDir := filepath.Join(dir, "sync")
+			err := os.Mkdir(targetDir, 0700)
+			Expect(err).To(BeNil())
+			target := filepath.Join(targetDir, "test.passu")
+			err = ioutil.WriteFile(target, []byte("old data"), 0600)
+			Expect(err).To(BeNil())
+			link := filepath.Join(dir, "test.passu")
+			err = os.Symlink(target, link)
+			Expect(err).To(BeNil())
+
+			db := passulib.NewPasswordDatabase("testpassword")
+			err = passu.WriteFileAtomic(link, db.Save(), "testpassword")
+			Expect(err).To(BeNil())
+
+			stat, err := os.Lstat(link)
+			Expect(err).To(BeNil())
+			Expect(stat.Mode() & os.ModeSymlink).NotTo(BeZero())
+
+			data, err := ioutil.ReadFile(target)
+			Expect(err).To(BeNil())
+			_, err = passulib.PasswordDatabaseFromData(data, "testpassword")
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("Backups", func() {
+		It("should back up the existing file", func() {
+			filePath := filepath.Join(dir, "test.passu")
+			err := ioutil.WriteFile(filePath, []byte("old data"), 0600)
+			Expect(err).To(BeNil())
+
+			err = passu.BackupFile(filePath, passu.BackupSettings{})
+			Expect(err).To(BeNil())
+
+			backups, err := passu.ListBackups(filePath, passu.BackupSettings{})
+			Expect(err).To(BeNil())
+			Expect(backups).To(HaveLen(1))
+
+			data, err := ioutil.ReadFile(backups[0].Path)
+			Expect(err).To(BeNil())
+			Expect(string(data)).To(Equal("old data"))
+		})
+		It("should prune old backups", func() {
+			filePath := filepath.Join(dir, "test.passu")
+			for _, name := range []string{"20180101-120000.000", "20180102-120000.000", "20180103-120000.000"} {
+				err := ioutil.WriteFile(filepath.Join(dir, "test.passu."+name+".bak"), []byte("data"), 0600)
+				Expect(err).To(BeNil())
+			}
+
+			err := passu.PruneBackups(filePath, passu.BackupSettings{Keep: 2})
+			Expect(err).To(BeNil())
+
+			backups, err := passu.ListBackups(filePath, passu.BackupSettings{})
+			Expect(err).To(BeNil())
+			Expect(backups).To(HaveLen(2))
+			Expect(filepath.Base(backups[1].Path)).To(Equal("test.passu.20180102-120000.000.bak"))
+		})
+		It("should restore a backup", func() {
+			filePath := filepath.Join(dir, "test.passu")
+			backupDb := passulib.NewPasswordDatabase("testpassword")
+			backupDb.AddEntry(passulib.PasswordEntry{
+				Name:     "old",
+				Password: "oldpassword",
+			})
+			err := ioutil.WriteFile(filePath, backupDb.Save(), 0600)
+			Expect(err).To(BeNil())
+			err = passu.BackupFile(filePath, passu.BackupSettings{})
+			Expect(err).To(BeNil())
+
+			db := passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{
+				Name:     "new",
+				Password: "newpassword",
+			})
+
+			output := ""
+			settings := passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText:     "test> ",
+				FilePath:       filePath,
+				MasterPassword: "testpassword",
+				PrintFunc: func(text string) {
+					output += text + "\n"
+				},
+			}
+
+			err = passu.RunCommand([]string{"backups", "diff", "1"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(strings.TrimSpace(output)).To(Equal("+ new\n- old"))
+
+			err = passu.RunCommand([]string{"backups", "restore", "1"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("old")
+			Expect(idx).NotTo(Equal(-1))
+			_, idx = db.GetEntry("new")
+			Expect(idx).To(Equal(-1))
+		})
+	})
+
+	Context("Locking", func() {
+		It("should refuse a second lock", func() {
+			filePath := filepath.Join(dir, "test.passu")
+
+			lock, err := passu.LockFile(filePath)
+			Expect(err).To(BeNil())
+
+			_, err = passu.LockFile(filePath)
+			Expect(err).To(BeAssignableToTypeOf(&passu.LockedError{}))
+			Expect(err.(*passu.LockedError).PID).To(Equal(os.Getpid()))
+			Expect(err.(*passu.LockedError).Stale()).To(BeFalse())
+
+			err = lock.Unlock()
+			Expect(err).To(BeNil())
+
+			lock, err = passu.LockFile(filePath)
+			Expect(err).To(BeNil())
+			lock.Unlock()
+		})
+		It("should break a lock", func() {
+			filePath := filepath.Join(dir, "test.passu")
+
+			_, err := passu.LockFile(filePath)
+			Expect(err).To(BeNil())
+
+			err = passu.BreakLock(filePath)
+			Expect(err).To(BeNil())
+
+			lock, err := passu.LockFile(filePath)
+			Expect(err).To(BeNil())
+			lock.Unlock()
+		})
+	})
+
+	Context("Change detection", func() {
+		var filePath string
+		var db *passulib.PasswordDatabase
+		var written []byte
+		var answer string
+		var prompts int
+		var settings passu.PromptSettings
+
+		BeforeEach(func() {
+			filePath = filepath.Join(dir, "test.passu")
+			prompts = 0
+
+			db = passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{
+				Name:     "local",
+				Password: "localpassword",
+			})
+			err := ioutil.WriteFile(filePath, db.Save(), 0600)
+			Expect(err).To(BeNil())
+
+			written = nil
+			settings = passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						prompts++
+						return answer
+					},
+				},
+				PromptText:     "test> ",
+				FilePath:       filePath,
+				MasterPassword: "testpassword",
+				PrintFunc:      func(text string) {},
+				WriteFileFunc: func(data []byte) error {
+					written = data
+					return nil
+				},
+			}
+			settings.FileState, err = passu.ReadFileState(filePath)
+			Expect(err).To(BeNil())
+
+			diskDb := passulib.NewPasswordDatabase("testpassword")
+			diskDb.AddEntry(passulib.PasswordEntry{
+				Name:     "local",
+				Password: "localpassword",
+			})
+			diskDb.AddEntry(passulib.PasswordEntry{
+				Name:     "remote",
+				Password: "remotepassword",
+			})
+			err = ioutil.WriteFile(filePath, diskDb.Save(), 0600)
+			Expect(err).To(BeNil())
+		})
+
+		It("should cancel saving over a changed file", func() {
+			answer = "c"
+			err := passu.RunCommand([]string{"save"}, db, &settings)
+
+			Expect(err).NotTo(BeNil())
+			Expect(written).To(BeNil())
+		})
+		It("should force overwrite a changed file", func() {
+			answer = "f"
+			err := passu.RunCommand([]string{"save"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(written).NotTo(BeNil())
+		})
+		It("should reload a changed file", func() {
+			answer = "r"
+			err := passu.RunCommand([]string{"save"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(written).To(BeNil())
+
+			_, idx := db.GetEntry("remote")
+			Expect(idx).NotTo(Equal(-1))
+		})
+		It("should merge a changed file", func() {
+			answer = "m"
+			err := passu.RunCommand([]string{"save"}, db, &settings)
+
+			Expect(err).To(BeNil())
+			Expect(written).NotTo(BeNil())
+
+			_, idx := db.GetEntry("remote")
+			Expect(idx).NotTo(Equal(-1))
+			_, idx = db.GetEntry("local")
+			Expect(idx).NotTo(Equal(-1))
+		})
+		It("should keep local deletions when merging", func() {
+			err := passu.RunCommand([]string{"passwords", "delete", "--yes", "local"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			answer = "m"
+			err = passu.RunCommand([]string{"save"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			_, idx := db.GetEntry("local")
+			Expect(idx).To(Equal(-1))
+			_, idx = db.GetEntry("remote")
+			Expect(idx).NotTo(Equal(-1))
+		})
+		It("should merge local edits without conflicts", func() {
+			err := passu.RunCommand([]string{"passwords", "edit", "local", "-d", "changed"}, db, &settings)
+			Expect(err).To(BeNil())
+
+			answer = "m"
+			err = passu.RunCommand([]string{"save"}, db, &settings)
+			Expect(err).To(BeNil())
+			Expect(prompts).To(Equal(1))
+
+			entry, _ := db.GetEntry("local")
+			Expect(entry.Description).To(Equal("changed"))
+		})
+	})
+
+	Context("Merge", func() {
+		var basePath, oursPath, theirsPath string
+
+		writeDb := func(filePath string, entries ...passulib.PasswordEntry) {
+			db := passulib.NewPasswordDatabase("testpassword")
+			for _, entry := range entries {
+				db.AddEntry(entry)
+			}
+			err := ioutil.WriteFile(filePath, db.Save(), 0600)
+			Expect(err).To(BeNil())
+		}
+
+		readDb := func(filePath string) *passulib.PasswordDatabase {
+			data, err := ioutil.ReadFile(filePath)
+			Expect(err).To(BeNil())
+			db, err := passulib.PasswordDatabaseFromData(data, "testpassword")
+			Expect(err).To(BeNil())
+			return db
+		}
+
+		settingsWithAnswer := func(answer string) passu.PromptSettings {
+			return passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						if p == "Master password: " {
+							return "testpassword"
+						}
+						return answer
+					},
+				},
+				PromptText: "test> ",
+				PrintFunc:  func(text string) {},
+			}
+		}
+
+		BeforeEach(func() {
+			basePath = filepath.Join(dir, "base.passu")
+			oursPath = filepath.Join(dir, "ours.passu")
+			theirsPath = filepath.Join(dir, "theirs.passu")
+		})
+
+		It("should merge changes from both sides", func() {
+			writeDb(basePath,
+				passulib.PasswordEntry{Name: "a", Password: "a"},
+				passulib.PasswordEntry{Name: "c", Password: "c"})
+			writeDb(oursPath,
+				passulib.PasswordEntry{Name: "a", Password: "changed"},
+				passulib.PasswordEntry{Name: "c", Password: "c"})
+			writeDb(theirsPath,
+				passulib.PasswordEntry{Name: "a", Password: "a"},
+				passulib.PasswordEntry{Name: "b", Password: "b"})
+
+			settings := settingsWithAnswer("")
+			err := passu.MergeFiles(basePath, oursPath, theirsPath, &settings)
+			Expect(err).To(BeNil())
+
+			db := readDb(oursPath)
+			entry, idx := db.GetEntry("a")
+			Expect(idx).NotTo(Equal(-1))
+			Expect(entry.Password).To(Equal("changed"))
+			_, idx = db.GetEntry("b")
+			Expect(idx).NotTo(Equal(-1))
+			_, idx = db.GetEntry("c")
+			Expect(idx).To(Equal(-1))
+		})
+		It("should merge without a common ancestor", func() {
+			err := ioutil.WriteFile(basePath, []byte{}, 0600)
+			Expect(err).To(BeNil())
+			writeDb(oursPath, passulib.PasswordEntry{Name: "a", Password: "a"})
+			writeDb(theirsPath, passulib.PasswordEntry{Name: "b", Password: "b"})
+
+			settings := settingsWithAnswer("")
+			err = passu.MergeFiles(basePath, oursPath, theirsPath, &settings)
+			Expect(err).To(BeNil())
+
+			db := readDb(oursPath)
+			_, idx := db.GetEntry("a")
+			Expect(idx).NotTo(Equal(-1))
+			_, idx = db.GetEntry("b")
+			Expect(idx).NotTo(Equal(-1))
+		})
+		It("should resolve conflicts", func() {
+			writeDb(basePath, passulib.PasswordEntry{Name: "a", Password: "a"})
+			writeDb(oursPath, passulib.PasswordEntry{Name: "a", Password: "ours"})
+			writeDb(theirsPath, passulib.PasswordEntry{Name: "a", Password: "theirs"})
+
+			settings := settingsWithAnswer("t")
+			err := passu.MergeFiles(basePath, oursPath, theirsPath, &settings)
+			Expect(err).To(BeNil())
+
+			entry, _ := readDb(oursPath).GetEntry("a")
+			Expect(entry.Password).To(Equal("theirs"))
+		})
+		It("should merge another file into the open database", func() {
+			writeDb(theirsPath,
+				passulib.PasswordEntry{Name: "a", Password: "theirs"},
+				passulib.PasswordEntry{Name: "b", Password: "b"})
+
+			db := passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{Name: "a", Password: "ours"})
+
+			settings := settingsWithAnswer("o")
+			settings.MasterPassword = "testpassword"
+			err := passu.RunCommand([]string{"merge", theirsPath}, db, &settings)
+			Expect(err).To(BeNil())
+
+			entry, _ := db.GetEntry("a")
+			Expect(entry.Password).To(Equal("ours"))
+			_, idx := db.GetEntry("b")
+			Expect(idx).NotTo(Equal(-1))
+		})
+	})
+
+	Context("Diff", func() {
+		var otherPath string
+		var db *passulib.PasswordDatabase
+
+		BeforeEach(func() {
+			db = passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{Name: "changed", Password: "old", Description: "description"})
+			db.AddEntry(passulib.PasswordEntry{Name: "old name", Password: "renamed"})
+			db.AddEntry(passulib.PasswordEntry{Name: "removed", Password: "removed"})
+
+			other := passulib.NewPasswordDatabase("testpassword")
+			other.AddEntry(passulib.PasswordEntry{Name: "added", Password: "added"})
+			other.AddEntry(passulib.PasswordEntry{Name: "changed", Password: "new", Description: "description"})
+			other.AddEntry(passulib.PasswordEntry{Name: "new name", Password: "renamed"})
+
+			otherPath = filepath.Join(dir, "other.passu")
+			err := ioutil.WriteFile(otherPath, other.Save(), 0600)
+			Expect(err).To(BeNil())
+		})
+
+		runDiff := func(args ...string) string {
+			output := ""
+			settings := passu.PromptSettings{
+				RL: &ReadlineMock{
+					"test> ",
+					func(p string) string {
+						return ""
+					},
+				},
+				PromptText:     "test> ",
+				MasterPassword: "testpassword",
+				PrintFunc: func(text string) {
+					output += text + "\n"
+				},
+			}
+
+			err := passu.RunCommand(append([]string{"diff"}, args...), db, &settings)
+			Expect(err).To(BeNil())
+			return strings.TrimSpace(output)
+		}
+
+		It("should show differences with masked passwords", func() {
+			Expect(runDiff(otherPath)).To(Equal("+ added\n~ changed\n    password: changed\n> old name -> new name\n- removed"))
+		})
+		It("should reveal changed passwords", func() {
+			Expect(runDiff("--reveal", otherPath)).To(Equal("+ added\n~ changed\n    password: old -> new\n> old name -> new name\n- removed"))
+		})
+		It("should not report entries that share a password as renames", func() {
+			db = passulib.NewPasswordDatabase("testpassword")
+			db.AddEntry(passulib.PasswordEntry{Name: "work mail", Password: "reused"})
+
+			other := passulib.NewPasswordDatabase("testpassword")
+			other.AddEntry(passulib.PasswordEntry{Name: "forum", Password: "reused"})
+			other.AddEntry(passulib.PasswordEntry{Name: "home mail", Password: "reused", Description: "personal"})
+			err := ioutil.WriteFile(otherPath, other.Save(), 0600)
+			Expect(err).To(BeNil())
+
+			Expect(runDiff(otherPath)).To(Equal("+ forum\n+ home mail\n- work mail"))
+		})
+	})
+
+	Context("Opening", func() {
+		It("should report a wrong password", func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+
+			_, err := passu.OpenDatabase(db.Save(), "wrongpassword")
+			Expect(err).To(Equal(passu.ErrWrongPassword))
+		})
+		It("should report an empty file as damaged", func() {
+			_, err := passu.OpenDatabase([]byte{}, "testpassword")
+			Expect(errors.Is(err, passu.ErrCorruptFile)).To(BeTrue())
+		})
+		It("should report a truncated file as damaged", func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+			data := db.Save()
+
+			_, err := passu.OpenDatabase(data[:len(data)/2], "testpassword")
+			Expect(errors.Is(err, passu.ErrCorruptFile)).To(BeTrue())
+			Expect(passu.ExitCode(err)).To(Equal(passu.ExitCorruptFile))
+		})
+		It("should report garbage as damaged", func() {
+			_, err := passu.OpenDatabase([]byte("not a password database"), "testpassword")
+			Expect(errors.Is(err, passu.ErrCorruptFile)).To(BeTrue())
+		})
+		It("should open a database", func() {
+			db := passulib.NewPasswordDatabase("testpassword")
+
+			_, err := passu.OpenDatabase(db.Save(), "testpassword")
+			Expect(err).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,256 @@
+package passu
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+	"sort"
+	"strings"
+)
+
+// Entry names containing "/" are treated as being in folders, like "work/aws/prod-root".
+
+// resolveName turns a name given relative to the current folder into a full entry name.
+// Only a leading "/", which makes the name relative to the root, and leading ".." elements,
+// which refer to parent folders, are interpreted. The rest of the name is kept as given.
+func resolveName(name string, settings *PromptSettings) string {
+	// Keep a trailing slash so that folder arguments stay recognizable
+	trailingSlash := strings.HasSuffix(name, "/")
+
+	folder := settings.CurrentFolder
+	if strings.HasPrefix(name, "/") {
+		folder = ""
+		name = strings.TrimPrefix(name, "/")
+	}
+	for name == ".." || strings.HasPrefix(name, "../") {
+		folder = parentFolder(folder)
+		name = strings.TrimPrefix(strings.TrimPrefix(name, ".."), "/")
+	}
+
+	if name == "" && trailingSlash && folder != "" {
+		return folder + "/"
+	}
+	return joinName(folder, name)
+}
+
+// joinName returns the full name of name in folder, without cleaning up either of them.
+func joinName(folder, name string) string {
+	switch {
+	case folder == "":
+		return name
+	case name == "":
+		return folder
+	default:
+		return folder + "/" + name
+	}
+}
+
+// baseName returns the name of an entry or folder without the folder it is in.
+func baseName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+func parentFolder(folder string) string {
+	idx := strings.LastIndex(folder, "/")
+	if idx == -1 {
+		return ""
+	}
+	return folder[:idx]
+}
+
+// relativeName returns name relative to folder, or the full name with a leading "/" if it is not in folder.
+func relativeName(name, folder string) string {
+	if folder == "" {
+		return name
+	}
+	if strings.HasPrefix(name, folder+"/") {
+		return strings.TrimPrefix(name, folder+"/")
+	}
+	return "/" + name
+}
+
+// entryArgument returns the entry name given as the first argument of a command, resolved against the current folder.
+func entryArgument(c *cli.Context, settings *PromptSettings) (string, error) {
+	if c.NArg() < 1 {
+		return "", missingArgument("name")
+	}
+	return resolveName(c.Args().Get(0), settings), nil
+}
+
+// existingEntryArgument is like entryArgument, but at the root folder it returns the argument as given
+// if an entry has exactly that name. This keeps entries whose names look like folder syntax,
+// such as "https://github.com", addressable. In other folders they can be given with a leading "/".
+func existingEntryArgument(c *cli.Context, db *passulib.PasswordDatabase, settings *PromptSettings) (string, error) {
+	name, err := entryArgument(c, settings)
+	if err != nil {
+		return "", err
+	}
+
+	if settings.CurrentFolder == "" {
+		if _, idx := db.GetEntry(c.Args().Get(0)); idx != -1 {
+			return c.Args().Get(0), nil
+		}
+	}
+	return name, nil
+}
+
+// entriesInFolder returns the entries in folder and its subfolders. An empty folder means all entries.
+func entriesInFolder(db *passulib.PasswordDatabase, folder string) []passulib.PasswordEntry {
+	entries := db.AllEntries()
+	if folder == "" {
+		return entries
+	}
+
+	result := make([]passulib.PasswordEntry, 0)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name, folder+"/") {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// printTree prints sorted entry names, which are relative to the listed folder, as an indented tree.
+func printTree(names []string, settings *PromptSettings) {
+	previous := []string{}
+	for _, name := range names {
+		parts := strings.Split(name, "/")
+
+		common := 0
+		for common < len(parts)-1 && common < len(previous)-1 && parts[common] == previous[common] {
+			common++
+		}
+
+		for depth := common; depth < len(parts)-1; depth++ {
+			settings.PrintFunc(fmt.Sprintf("%v%v/", strings.Repeat("  ", depth), parts[depth]))
+		}
+		settings.PrintFunc(fmt.Sprintf("%v%v", strings.Repeat("  ", len(parts)-1), parts[len(parts)-1]))
+
+		previous = parts
+	}
+}
+
+// folderPrompt returns the prompt text for the given folder, based on the prompt text of the root folder.
+func folderPrompt(rootPrompt, folder string) string {
+	if folder == "" {
+		return rootPrompt
+	}
+	return fmt.Sprintf("%v:/%v> ", strings.TrimSuffix(rootPrompt, "> "), folder)
+}
+
+type folderOutput struct {
+	Folder string `json:"folder" yaml:"folder"`
+}
+
+func folderCommands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Command {
+	return []cli.Command{
+		{
+			Name:      "cd",
+			Usage:     "Change the current folder",
+			ArgsUsage: "[folder]",
+			Action: func(c *cli.Context) error {
+				folder := ""
+				if c.NArg() >= 1 {
+					folder = strings.TrimSuffix(resolveName(c.Args().Get(0), settings), "/")
+				}
+
+				if folder != "" && len(entriesInFolder(db, folder)) == 0 {
+					return errors.New("Folder not found")
+				}
+
+				settings.CurrentFolder = folder
+				return nil
+			},
+		},
+		{
+			Name:  "pwd",
+			Usage: "Show the current folder",
+			Action: func(c *cli.Context) error {
+				folder := "/" + settings.CurrentFolder
+				return printData(settings, folderOutput{Folder: folder}, func() {
+					settings.PrintFunc(folder)
+				})
+			},
+		},
+	}
+}
+
+func moveCommand(db *passulib.PasswordDatabase, settings *PromptSettings) cli.Command {
+	return cli.Command{
+		Name:      "move",
+		Usage:     "Move or rename an entry or a folder",
+		ArgsUsage: "<source> <destination>",
+		Aliases:   []string{"mv"},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 2 {
+				return missingArgument("source and destination")
+			}
+
+			source, err := existingEntryArgument(c, db, settings)
+			if err != nil {
+				return err
+			}
+			if _, idx := db.GetEntry(source); idx == -1 {
+				source = strings.TrimSuffix(source, "/")
+			}
+			destination := resolveName(c.Args().Get(1), settings)
+
+			// Maps old names to new names
+			moves := make(map[string]string)
+
+			if _, idx := db.GetEntry(source); idx != -1 {
+				target := strings.TrimSuffix(destination, "/")
+				if strings.HasSuffix(destination, "/") || len(entriesInFolder(db, target)) > 0 {
+					target = joinName(target, baseName(source))
+				}
+				moves[source] = target
+			} else {
+				entries := entriesInFolder(db, source)
+				if source == "" || len(entries) == 0 {
+					return ErrEntryNotFound
+				}
+
+				target := strings.TrimSuffix(destination, "/")
+				if strings.HasSuffix(destination, "/") {
+					target = joinName(target, baseName(source))
+				}
+				for _, entry := range entries {
+					moves[entry.Name] = joinName(target, strings.TrimPrefix(entry.Name, source+"/"))
+				}
+			}
+
+			oldNames := make([]string, 0, len(moves))
+			for oldName, newName := range moves {
+				if _, exists := moves[newName]; !exists {
+					if _, idx := db.GetEntry(newName); idx != -1 {
+						return fmt.Errorf("Entry %v already exists", newName)
+					}
+				}
+				oldNames = append(oldNames, oldName)
+			}
+			sort.Strings(oldNames)
+
+			// Remove all entries before adding any, as a new name can be the old name of another moved entry
+			moved := make([]passulib.PasswordEntry, 0, len(oldNames))
+			for _, oldName := range oldNames {
+				entry, _ := db.GetEntry(oldName)
+				_, err := db.RemoveEntry(oldName)
+				if err != nil {
+					return err
+				}
+				entry.Name = moves[oldName]
+				moved = append(moved, entry)
+			}
+			for _, entry := range moved {
+				err := db.AddEntry(entry)
+				if err != nil {
+					return err
+				}
+			}
+
+			printMessage(settings, fmt.Sprintf("Moved %v entries", len(moves)))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,218 @@
+package passu
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+)
+
+const journalLimit = 100
+
+// snapshot is a copy of the contents of a database at one point of the session.
+type snapshot struct {
+	Entries       []passulib.PasswordEntry
+	DefaultPolicy passulib.PasswordPolicy
+	Password      string
+}
+
+// databaseSnapshot takes a snapshot of the entries and default policy of db.
+func databaseSnapshot(db *passulib.PasswordDatabase) snapshot {
+	return snapshot{
+		Entries:       db.AllEntries(),
+		DefaultPolicy: db.GetDefaultPolicy(),
+	}
+}
+
+// takeSnapshot takes a snapshot of db that also includes the master password of the session.
+func takeSnapshot(db *passulib.PasswordDatabase, settings *PromptSettings) snapshot {
+	s := databaseSnapshot(db)
+	s.Password = settings.MasterPassword
+	return s
+}
+
+func (s snapshot) equal(other snapshot) bool {
+	return s.DefaultPolicy == other.DefaultPolicy &&
+		s.Password == other.Password &&
+		len(diffEntries(s.Entries, other.Entries)) == 0
+}
+
+// restore replaces the contents of db with the snapshot.
+// The master password is restored as well if settings is given.
+func (s snapshot) restore(db *passulib.PasswordDatabase, settings *PromptSettings) error {
+	for _, entry := range db.AllEntries() {
+		_, err := db.RemoveEntry(entry.Name)
+		if err != nil {
+			return err
+		}
+	}
+	for _, entry := range s.Entries {
+		err := db.AddEntry(entry)
+		if err != nil {
+			return err
+		}
+	}
+	err := db.SetDefaultPolicy(s.DefaultPolicy)
+	if err != nil {
+		return err
+	}
+
+	if settings != nil && s.Password != settings.MasterPassword {
+		db.SetPassword(s.Password)
+		settings.MasterPassword = s.Password
+	}
+	return nil
+}
+
+type journalRecord struct {
+	Command string
+	Before  snapshot
+	After   snapshot
+}
+
+// journal records the changes made by commands during a session, so they can be undone and redone.
+type journal struct {
+	saved   snapshot
+	records []journalRecord
+	undone  []journalRecord
+	pending *journalRecord
+	replay  bool
+}
+
+func newJournal(db *passulib.PasswordDatabase, settings *PromptSettings) *journal {
+	return &journal{saved: takeSnapshot(db, settings)}
+}
+
+// begin takes a snapshot before a command is run.
+func (j *journal) begin(db *passulib.PasswordDatabase, settings *PromptSettings, command string) {
+	j.pending = &journalRecord{Command: command, Before: takeSnapshot(db, settings)}
+}
+
+// end records the changes made by the command started with begin, if any.
+func (j *journal) end(db *passulib.PasswordDatabase, settings *PromptSettings) {
+	pending := j.pending
+	j.pending = nil
+	if pending == nil || j.replay {
+		j.replay = false
+		return
+	}
+
+	pending.After = takeSnapshot(db, settings)
+	if pending.Before.equal(pending.After) {
+		return
+	}
+
+	j.records = append(j.records, *pending)
+	if len(j.records) > journalLimit {
+		j.records = j.records[len(j.records)-journalLimit:]
+	}
+	j.undone = nil
+}
+
+// markSaved records the current contents of db as the saved state.
+func (j *journal) markSaved(db *passulib.PasswordDatabase, settings *PromptSettings) {
+	j.saved = takeSnapshot(db, settings)
+}
+
+// reset forgets all recorded changes, for example after the database has been reloaded.
+func (j *journal) reset(db *passulib.PasswordDatabase, settings *PromptSettings) {
+	j.records = nil
+	j.undone = nil
+	j.markSaved(db, settings)
+}
+
+func (j *journal) apply(db *passulib.PasswordDatabase, settings *PromptSettings, state snapshot) error {
+	j.replay = true
+	err := state.restore(db, settings)
+	if err != nil {
+		return err
+	}
+
+	db.Modified = !j.saved.equal(takeSnapshot(db, settings))
+	return nil
+}
+
+func (j *journal) undo(db *passulib.PasswordDatabase, settings *PromptSettings) (journalRecord, error) {
+	if len(j.records) == 0 {
+		return journalRecord{}, errors.New("Nothing to undo")
+	}
+
+	record := j.records[len(j.records)-1]
+	err := j.apply(db, settings, record.Before)
+	if err != nil {
+		return journalRecord{}, err
+	}
+
+	j.records = j.records[:len(j.records)-1]
+	j.undone = append(j.undone, record)
+	return record, nil
+}
+
+func (j *journal) redo(db *passulib.PasswordDatabase, settings *PromptSettings) (journalRecord, error) {
+	if len(j.undone) == 0 {
+		return journalRecord{}, errors.New("Nothing to redo")
+	}
+
+	record := j.undone[len(j.undone)-1]
+	err := j.apply(db, settings, record.After)
+	if err != nil {
+		return journalRecord{}, err
+	}
+
+	j.undone = j.undone[:len(j.undone)-1]
+	j.records = append(j.records, record)
+	return record, nil
+}
+
+// sessionJournal returns the journal of the session, creating it on first use.
+func sessionJournal(db *passulib.PasswordDatabase, settings *PromptSettings) *journal {
+	if settings.journal == nil {
+		settings.journal = newJournal(db, settings)
+	}
+	return settings.journal
+}
+
+func journalCommands(db *passulib.PasswordDatabase, settings *PromptSettings) []cli.Command {
+	return []cli.Command{
+		{
+			Name:  "undo",
+			Usage: "Undo the last change",
+			Action: func(c *cli.Context) error {
+				record, err := sessionJournal(db, settings).undo(db, settings)
+				if err != nil {
+					return err
+				}
+
+				printMessage(settings, fmt.Sprintf("Undid \"%v\"", record.Command))
+				return nil
+			},
+		},
+		{
+			Name:  "redo",
+			Usage: "Redo the last undone change",
+			Action: func(c *cli.Context) error {
+				record, err := sessionJournal(db, settings).redo(db, settings)
+				if err != nil {
+					return err
+				}
+
+				printMessage(settings, fmt.Sprintf("Redid \"%v\"", record.Command))
+				return nil
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "Show unsaved changes",
+			Action: func(c *cli.Context) error {
+				j := sessionJournal(db, settings)
+				current := takeSnapshot(db, settings)
+				if j.saved.equal(current) {
+					printMessage(settings, "No unsaved changes")
+					return nil
+				}
+
+				return printSnapshotDiff(j.saved, current, false, settings)
+			},
+		},
+	}
+}
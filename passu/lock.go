@@ -0,0 +1,100 @@
+package passu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// FileLock is an advisory lock on a database file, held by a lock file next to it.
+type FileLock struct {
+	path string
+}
+
+// LockedError is returned by LockFile when another process holds the lock.
+type LockedError struct {
+	PID  int
+	Host string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("Database is locked by pid %v on host %v", e.PID, e.Host)
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Stale reports whether the lock was left behind by a process that is no longer running on this host.
+func (e *LockedError) Stale() bool {
+	host, _ := os.Hostname()
+	if e.Host != host {
+		return false
+	}
+
+	proc, err := os.FindProcess(e.PID)
+	if err != nil {
+		return true
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err != nil && err != syscall.EPERM
+}
+
+func lockPath(filePath string) string {
+	return filePath + ".lock"
+}
+
+// LockFile takes the lock for the given database file.
+func LockFile(filePath string) (*FileLock, error) {
+	path := lockPath(filePath)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, readLock(path)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	host, _ := os.Hostname()
+	_, err = fmt.Fprintf(f, "%v %v\n", os.Getpid(), host)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &FileLock{path: path}, nil
+}
+
+func readLock(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lockErr := &LockedError{Host: "unknown"}
+	fields := strings.Fields(string(data))
+	if len(fields) >= 1 {
+		lockErr.PID, _ = strconv.Atoi(fields[0])
+	}
+	if len(fields) >= 2 {
+		lockErr.Host = fields[1]
+	}
+	return lockErr
+}
+
+// BreakLock removes the lock of the given database file regardless of who holds it.
+func BreakLock(filePath string) error {
+	err := os.Remove(lockPath(filePath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l *FileLock) Unlock() error {
+	return os.Remove(l.path)
+}
@@ -0,0 +1,146 @@
+package passu
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+	"sort"
+	"strings"
+)
+
+// Maximum number of entries offered when a name is ambiguous
+const pickerLimit = 10
+
+type ambiguousEntryError struct {
+	name    string
+	matches []string
+}
+
+func (e *ambiguousEntryError) Error() string {
+	return fmt.Sprintf("Entry name %v is ambiguous. Matching entries: %v", e.name, strings.Join(e.matches, ", "))
+}
+
+func (e *ambiguousEntryError) Is(target error) bool {
+	return target == ErrAmbiguousEntry
+}
+
+// matchingEntries returns the entries that name could refer to when there is no entry with exactly that name.
+// Case-insensitive exact matches win, then entries that have name as a case-insensitive prefix,
+// and if there are none, the results of a fuzzy search.
+func matchingEntries(db *passulib.PasswordDatabase, name string) []passulib.PasswordEntry {
+	entries := db.AllEntries()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	lowerName := strings.ToLower(name)
+	exact := make([]passulib.PasswordEntry, 0)
+	prefixed := make([]passulib.PasswordEntry, 0)
+	for _, entry := range entries {
+		lowerEntry := strings.ToLower(entry.Name)
+		if lowerEntry == lowerName {
+			exact = append(exact, entry)
+		}
+		if strings.HasPrefix(lowerEntry, lowerName) {
+			prefixed = append(prefixed, entry)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	if len(prefixed) > 0 {
+		return prefixed
+	}
+
+	results, _ := searchEntries(entries, name, searchFuzzy)
+	fuzzy := make([]passulib.PasswordEntry, 0)
+	for _, result := range results {
+		if result.Field == "name" {
+			fuzzy = append(fuzzy, result.Entry)
+		}
+	}
+	return fuzzy
+}
+
+// pickEntry asks the user to choose one of matches from a numbered list, which shows at most pickerLimit entries.
+func pickEntry(name string, matches []passulib.PasswordEntry, settings *PromptSettings) (passulib.PasswordEntry, error) {
+	printInstruction(settings, fmt.Sprintf("Several entries match %v:", name))
+	if len(matches) > pickerLimit {
+		printInstruction(settings, fmt.Sprintf("Showing the first %v of %v matches. Use a longer name to see the others.", pickerLimit, len(matches)))
+		matches = matches[:pickerLimit]
+	}
+	for idx, entry := range matches {
+		printInstruction(settings, fmt.Sprintf("%v) %v", idx+1, entry.Name))
+	}
+
+	choice := promptInt(fmt.Sprintf("Select entry [1-%v]: ", len(matches)), settings)
+	if !choice.Valid || choice.Int64 < 1 || choice.Int64 > int64(len(matches)) {
+		return passulib.PasswordEntry{}, errors.New("No entry selected")
+	}
+	return matches[choice.Int64-1], nil
+}
+
+// lookupEntry returns the entry that name refers to. Names that don't match an entry exactly are resolved
+// with matchingEntries. If several entries match, the user picks one in the interactive prompt,
+// and an error matching ErrAmbiguousEntry is returned otherwise.
+func lookupEntry(db *passulib.PasswordDatabase, name string, settings *PromptSettings) (passulib.PasswordEntry, error) {
+	if entry, idx := db.GetEntry(name); idx != -1 {
+		return entry, nil
+	}
+
+	matches := matchingEntries(db, name)
+	switch {
+	case len(matches) == 0:
+		return passulib.PasswordEntry{}, entryNotFound(db, name)
+	case len(matches) == 1:
+		return matches[0], nil
+	case !settings.Interactive:
+		names := make([]string, len(matches))
+		for idx, entry := range matches {
+			names[idx] = entry.Name
+		}
+		return passulib.PasswordEntry{}, &ambiguousEntryError{name: name, matches: names}
+	default:
+		return pickEntry(name, matches, settings)
+	}
+}
+
+// findEntry returns the entry named by the first argument of a command, resolved with lookupEntry.
+func findEntry(c *cli.Context, db *passulib.PasswordDatabase, settings *PromptSettings) (passulib.PasswordEntry, error) {
+	name, err := existingEntryArgument(c, db, settings)
+	if err != nil {
+		return passulib.PasswordEntry{}, err
+	}
+	return lookupEntry(db, name, settings)
+}
+
+// findEntryToChange is like findEntry, for commands that modify the entry. A name that doesn't match an entry exactly
+// is only accepted in the interactive prompt, after the user has picked or confirmed the entry.
+func findEntryToChange(c *cli.Context, db *passulib.PasswordDatabase, settings *PromptSettings) (passulib.PasswordEntry, error) {
+	name, err := existingEntryArgument(c, db, settings)
+	if err != nil {
+		return passulib.PasswordEntry{}, err
+	}
+
+	if entry, idx := db.GetEntry(name); idx != -1 {
+		return entry, nil
+	}
+	if !settings.Interactive {
+		return passulib.PasswordEntry{}, entryNotFound(db, name)
+	}
+
+	matches := matchingEntries(db, name)
+	switch len(matches) {
+	case 0:
+		return passulib.PasswordEntry{}, entryNotFound(db, name)
+	case 1:
+		confirm := promptBool(fmt.Sprintf("Change entry %v? [y/n]: ", matches[0].Name), settings)
+		if !confirm.Valid || !confirm.Bool {
+			return passulib.PasswordEntry{}, errors.New("Change cancelled")
+		}
+		return matches[0], nil
+	default:
+		return pickEntry(name, matches, settings)
+	}
+}
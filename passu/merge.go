@@ -0,0 +1,295 @@
+package passu
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+type mergeConflict struct {
+	Name    string // Entry name. Empty for the default policy.
+	Base    *passulib.PasswordEntry
+	Ours    *passulib.PasswordEntry
+	Theirs  *passulib.PasswordEntry
+	HasBase bool
+}
+
+// mergeResolver decides a conflict. It returns true if the version of theirs should be used.
+type mergeResolver func(conflict mergeConflict) (bool, error)
+
+func entryMap(db *passulib.PasswordDatabase) map[string]*passulib.PasswordEntry {
+	entries := db.AllEntries()
+	result := make(map[string]*passulib.PasswordEntry, len(entries))
+	for idx := range entries {
+		result[entries[idx].Name] = &entries[idx]
+	}
+	return result
+}
+
+func entriesEqual(a, b *passulib.PasswordEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return len(changedFields(*a, *b)) == 0
+}
+
+// applyEntry makes the entry called name in db match entry. A nil entry removes it.
+func applyEntry(db *passulib.PasswordDatabase, name string, current, entry *passulib.PasswordEntry) error {
+	switch {
+	case entry == nil:
+		_, err := db.RemoveEntry(name)
+		return err
+	case current == nil:
+		return db.AddEntry(*entry)
+	default:
+		return db.UpdateEntry(name, *entry)
+	}
+}
+
+// mergeDatabases applies the changes made in theirs relative to base into ours.
+// If base is nil, entries missing from one side are treated as added rather than deleted.
+// Changes made on both sides are passed to resolve. It returns the number of changes applied to ours and the number of conflicts.
+func mergeDatabases(base, ours, theirs *passulib.PasswordDatabase, resolve mergeResolver) (int, int, error) {
+	baseEntries := map[string]*passulib.PasswordEntry{}
+	if base != nil {
+		baseEntries = entryMap(base)
+	}
+	ourEntries := entryMap(ours)
+	theirEntries := entryMap(theirs)
+
+	names := make([]string, 0, len(ourEntries)+len(theirEntries))
+	for name := range ourEntries {
+		names = append(names, name)
+	}
+	for name := range theirEntries {
+		if _, ok := ourEntries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	applied, conflicts := 0, 0
+	for _, name := range names {
+		b, o, t := baseEntries[name], ourEntries[name], theirEntries[name]
+
+		useTheirs := false
+		switch {
+		case entriesEqual(o, t):
+			continue
+		case b != nil && entriesEqual(o, b):
+			useTheirs = true
+		case b != nil && entriesEqual(t, b):
+			continue
+		case b == nil && o == nil:
+			useTheirs = true
+		case b == nil && t == nil:
+			continue
+		default:
+			conflicts++
+			var err error
+			useTheirs, err = resolve(mergeConflict{Name: name, Base: b, Ours: o, Theirs: t, HasBase: base != nil})
+			if err != nil {
+				return applied, conflicts, err
+			}
+		}
+
+		if useTheirs {
+			err := applyEntry(ours, name, o, t)
+			if err != nil {
+				return applied, conflicts, err
+			}
+			applied++
+		}
+	}
+
+	basePolicy, ourPolicy, theirPolicy := passulib.PasswordPolicy{}, ours.GetDefaultPolicy(), theirs.GetDefaultPolicy()
+	if base != nil {
+		basePolicy = base.GetDefaultPolicy()
+	}
+	if ourPolicy != theirPolicy && !(base != nil && theirPolicy == basePolicy) {
+		useTheirs := base != nil && ourPolicy == basePolicy
+		if !useTheirs {
+			conflicts++
+			var err error
+			useTheirs, err = resolve(mergeConflict{HasBase: base != nil})
+			if err != nil {
+				return applied, conflicts, err
+			}
+		}
+
+		if useTheirs {
+			err := ours.SetDefaultPolicy(theirPolicy)
+			if err != nil {
+				return applied, conflicts, err
+			}
+			applied++
+		}
+	}
+
+	return applied, conflicts, nil
+}
+
+func describeSide(hasBase bool, base, entry, other *passulib.PasswordEntry) string {
+	switch {
+	case entry == nil:
+		return "deleted"
+	case hasBase && base == nil:
+		return "added"
+	case hasBase:
+		return fmt.Sprintf("changed %v", strings.Join(changedFields(*base, *entry), ", "))
+	case other != nil:
+		return fmt.Sprintf("differs in %v", strings.Join(changedFields(*other, *entry), ", "))
+	default:
+		return "exists"
+	}
+}
+
+// promptResolver asks the user to resolve each conflict. The labels name the two sides in the prompt.
+func promptResolver(settings *PromptSettings, ourLabel, theirLabel string) mergeResolver {
+	return func(conflict mergeConflict) (bool, error) {
+		var prompt string
+		if conflict.Name == "" {
+			prompt = fmt.Sprintf("Default policy changed on both sides. Keep [%v] or [%v] version: ", ourLabel, theirLabel)
+		} else {
+			prompt = fmt.Sprintf("Conflict in %v (%v: %v, %v: %v). Keep [%v] or [%v] version: ",
+				conflict.Name,
+				ourLabel, describeSide(conflict.HasBase, conflict.Base, conflict.Ours, conflict.Theirs),
+				theirLabel, describeSide(conflict.HasBase, conflict.Base, conflict.Theirs, conflict.Ours),
+				ourLabel, theirLabel)
+		}
+
+		settings.RL.SetPrompt(prompt)
+		defer settings.RL.SetPrompt(settings.PromptText)
+
+		for {
+			inp, err := settings.RL.Readline()
+			if err != nil {
+				return false, fmt.Errorf("%w: %v", ErrMergeConflict, err)
+			}
+
+			switch strings.ToLower(strings.TrimSpace(inp)) {
+			case ourLabel:
+				return false, nil
+			case theirLabel:
+				return true, nil
+			}
+		}
+	}
+}
+
+// openDatabaseData decrypts database data with the current master password,
+// or with a password asked using prompt if that fails. The password that opened the database is returned.
+func openDatabaseData(data []byte, prompt string, settings *PromptSettings) (*passulib.PasswordDatabase, string, error) {
+	db, err := passulib.PasswordDatabaseFromData(data, settings.MasterPassword)
+	if err == nil {
+		return db, settings.MasterPassword, nil
+	}
+
+	pwInput, err := settings.RL.ReadPassword(prompt)
+	if err != nil {
+		return nil, "", err
+	}
+	db, err = OpenDatabase(data, string(pwInput))
+	if err != nil {
+		return nil, "", err
+	}
+	return db, string(pwInput), nil
+}
+
+func openDatabaseFile(filePath string, settings *PromptSettings) (*passulib.PasswordDatabase, string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	return openDatabaseData(data, fmt.Sprintf("Password for %v: ", filePath), settings)
+}
+
+// MergeFiles performs a three-way merge of database files and writes the result to oursPath,
+// using the master password of ours. Conflicts are resolved interactively.
+// The arguments follow the order of git merge drivers, so it can be used as one with "passu merge %O %A %B".
+// An empty base file, which git passes when there is no common ancestor, merges without deleting entries.
+func MergeFiles(basePath, oursPath, theirsPath string, settings *PromptSettings) error {
+	password, err := ReadMasterPassword("Master password: ", settings)
+	if err != nil {
+		return err
+	}
+	settings.MasterPassword = password
+
+	ours, oursPassword, err := openDatabaseFile(oursPath, settings)
+	if err != nil {
+		return err
+	}
+
+	var base *passulib.PasswordDatabase
+	baseData, err := ioutil.ReadFile(basePath)
+	if err != nil {
+		return err
+	}
+	if len(baseData) > 0 {
+		base, _, err = openDatabaseData(baseData, fmt.Sprintf("Password for %v: ", basePath), settings)
+		if err != nil {
+			return err
+		}
+	}
+
+	theirs, _, err := openDatabaseFile(theirsPath, settings)
+	if err != nil {
+		return err
+	}
+
+	applied, conflicts, err := mergeDatabases(base, ours, theirs, promptResolver(settings, "o", "t"))
+	if err != nil {
+		return err
+	}
+
+	err = WriteFileAtomic(oursPath, ours.Save(), oursPassword)
+	if err != nil {
+		return err
+	}
+
+	printMessage(settings, fmt.Sprintf("Merged %v changes, resolved %v conflicts", applied, conflicts))
+	return nil
+}
+
+func mergeCommand(db *passulib.PasswordDatabase, settings *PromptSettings) cli.Command {
+	return cli.Command{
+		Name:      "merge",
+		Usage:     "Merge entries of another database file into this one",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "base, b",
+				Usage: "Common ancestor of both databases. Without it, entries are never deleted",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return missingArgument("file")
+			}
+
+			theirs, _, err := openDatabaseFile(c.Args().Get(0), settings)
+			if err != nil {
+				return err
+			}
+
+			var base *passulib.PasswordDatabase
+			if c.IsSet("base") {
+				base, _, err = openDatabaseFile(c.String("base"), settings)
+				if err != nil {
+					return err
+				}
+			}
+
+			applied, conflicts, err := mergeDatabases(base, db, theirs, promptResolver(settings, "o", "t"))
+			if err != nil {
+				return err
+			}
+
+			printMessage(settings, fmt.Sprintf("Merged %v changes, resolved %v conflicts", applied, conflicts))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,117 @@
+package passu
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"strings"
+)
+
+// Output formats of command results
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// ValidFormat reports whether format is a supported output format.
+func ValidFormat(format string) bool {
+	return format == FormatText || format == FormatJSON || format == FormatYAML
+}
+
+func structuredOutput(settings *PromptSettings) bool {
+	return settings.Format == FormatJSON || settings.Format == FormatYAML
+}
+
+// printData prints the result of a command. In text mode, text is called to print it through PrintFunc.
+// Otherwise data is encoded as a single document in the selected format.
+func printData(settings *PromptSettings, data interface{}, text func()) error {
+	var bytes []byte
+	var err error
+
+	switch settings.Format {
+	case FormatJSON:
+		bytes, err = json.MarshalIndent(data, "", "  ")
+	case FormatYAML:
+		bytes, err = yaml.Marshal(data)
+	case "", FormatText:
+		text()
+		return nil
+	default:
+		return fmt.Errorf("Unknown output format %q", settings.Format)
+	}
+
+	if err != nil {
+		return err
+	}
+	settings.PrintFunc(strings.TrimSuffix(string(bytes), "\n"))
+	return nil
+}
+
+type messageOutput struct {
+	Message string `json:"message" yaml:"message"`
+}
+
+// printInstruction prints text that guides the user through interactive input through InstructFunc,
+// which keeps it apart from the output of a command.
+func printInstruction(settings *PromptSettings, text string) {
+	if settings.InstructFunc != nil {
+		settings.InstructFunc(text)
+	}
+}
+
+// printMessage prints an informational message, as a document with a message field in structured output formats.
+func printMessage(settings *PromptSettings, text string) {
+	printData(settings, messageOutput{Message: text}, func() {
+		settings.PrintFunc(text)
+	})
+}
+
+type entrySummaryOutput struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+type entryOutput struct {
+	Name           string `json:"name" yaml:"name"`
+	PasswordLength int    `json:"password_length" yaml:"password_length"`
+	Description    string `json:"description" yaml:"description"`
+}
+
+type passwordOutput struct {
+	Name     string `json:"name" yaml:"name"`
+	Password string `json:"password" yaml:"password"`
+}
+
+type policyOutput struct {
+	Length    int64    `json:"length" yaml:"length"`
+	Lowercase bool     `json:"lowercase" yaml:"lowercase"`
+	Uppercase bool     `json:"uppercase" yaml:"uppercase"`
+	Numbers   bool     `json:"numbers" yaml:"numbers"`
+	Special   bool     `json:"special" yaml:"special"`
+	Inherited []string `json:"inherited,omitempty" yaml:"inherited,omitempty"` // Fields that come from the default policy
+}
+
+type backupOutput struct {
+	Number int    `json:"number" yaml:"number"`
+	Time   string `json:"time" yaml:"time"`
+	Size   int64  `json:"size" yaml:"size"`
+}
+
+type fieldChangeOutput struct {
+	Field string `json:"field" yaml:"field"`
+	From  string `json:"from,omitempty" yaml:"from,omitempty"`
+	To    string `json:"to,omitempty" yaml:"to,omitempty"`
+}
+
+type changeOutput struct {
+	Name    string              `json:"name" yaml:"name"`
+	Kind    string              `json:"kind" yaml:"kind"`
+	OldName string              `json:"old_name,omitempty" yaml:"old_name,omitempty"`
+	Fields  []fieldChangeOutput `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+type diffOutput struct {
+	Changes               []changeOutput     `json:"changes" yaml:"changes"`
+	DefaultPolicy         *fieldChangeOutput `json:"default_policy,omitempty" yaml:"default_policy,omitempty"`
+	MasterPasswordChanged bool               `json:"master_password_changed,omitempty" yaml:"master_password_changed,omitempty"`
+}
@@ -16,13 +16,36 @@ type IReadline interface {
 }
 
 type PromptSettings struct {
-	RL            IReadline
-	PromptText    string
-	FilePath      string
-	PrintFunc     func(text string)
-	WriteFileFunc func(data []byte) error
-	CopyFunc      func(text string) error
-	ExitFunc      func()
+	RL             IReadline
+	PromptText     string
+	CurrentFolder  string
+	FilePath       string
+	ReadOnly       bool
+	Interactive    bool // Ask the user instead of failing when input is ambiguous
+	AutoReload     bool
+	FileState      FileState
+	MasterPassword string
+	PasswordSource func() (string, error)
+	Backup         BackupSettings
+	Format         string
+	PrintFunc      func(text string)
+	InstructFunc   func(text string) // Prints instructions for interactive input, which are dropped if nil
+	WriteFileFunc  func(data []byte) error
+	CopyFunc       func(text string) error
+	ExitFunc       func()
+
+	journal *journal
+}
+
+// ReadMasterPassword reads the master password from the configured password source,
+// or from the terminal using prompt if there is none.
+func ReadMasterPassword(prompt string, settings *PromptSettings) (string, error) {
+	if settings.PasswordSource != nil {
+		return settings.PasswordSource()
+	}
+
+	pwInput, err := settings.RL.ReadPassword(prompt)
+	return string(pwInput), err
 }
 
 func createCli(db *passulib.PasswordDatabase, settings *PromptSettings) *cli.App {
@@ -33,6 +56,15 @@ func createCli(db *passulib.PasswordDatabase, settings *PromptSettings) *cli.App
 	cliApp.HideVersion = true
 	cliApp.ExitErrHandler = func(c *cli.Context, err error) {}
 
+	cliApp.Before = func(c *cli.Context) error {
+		sessionJournal(db, settings).begin(db, settings, strings.Join(c.Args(), " "))
+		return nil
+	}
+	cliApp.After = func(c *cli.Context) error {
+		sessionJournal(db, settings).end(db, settings)
+		return nil
+	}
+
 	cliApp.Commands = commands(db, settings)
 
 	return cliApp
@@ -44,15 +76,24 @@ func CreatePrompt(db *passulib.PasswordDatabase, settings *PromptSettings) func(
 		shouldExit = true
 	}
 
+	settings.Interactive = true
 	cliApp := createCli(db, settings)
 
-	inputReader, err := readline.New(settings.PromptText)
+	inputReader, err := readline.NewEx(&readline.Config{
+		Prompt:       settings.PromptText,
+		AutoComplete: NewCompleter(db, settings),
+	})
 	if err != nil {
 		panic(err)
 	}
 
+	rootPrompt := settings.PromptText
+
 	return func() error {
 		for {
+			settings.PromptText = folderPrompt(rootPrompt, settings.CurrentFolder)
+			inputReader.SetPrompt(settings.PromptText)
+
 			input, err := inputReader.Readline()
 			if err == readline.ErrInterrupt {
 				input = "exit"
@@ -64,6 +105,18 @@ func CreatePrompt(db *passulib.PasswordDatabase, settings *PromptSettings) func(
 				continue
 			}
 
+			if settings.AutoReload && !db.Modified {
+				changed, err := fileChanged(settings, true)
+				if err == nil && changed {
+					err = reloadDatabase(db, settings)
+					if err != nil {
+						settings.PrintFunc(fmt.Sprint("ERROR:", err))
+					} else {
+						settings.PrintFunc("Database file changed on disk. Reloaded.")
+					}
+				}
+			}
+
 			sInput, err := shellquote.Split(input)
 			if err != nil {
 				settings.PrintFunc(fmt.Sprint("ERROR:", err))
@@ -0,0 +1,282 @@
+package passu
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/winded/passu-lib"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Search modes of searchEntries
+const (
+	searchSubstring = iota
+	searchFuzzy
+	searchRegex
+)
+
+// Number of suggestions shown when an entry is not found
+const suggestionLimit = 3
+
+type searchResult struct {
+	Entry passulib.PasswordEntry
+	Field string // The field that matched, "name" or "description"
+	Score int
+}
+
+type searchResultOutput struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Field       string `json:"field" yaml:"field"`
+}
+
+// substringScore scores a case-insensitive substring match of query in text.
+// Exact matches score highest, then prefixes of the whole text or of its last path element, then other substrings.
+func substringScore(query, text string) (int, bool) {
+	query, text = strings.ToLower(query), strings.ToLower(text)
+	idx := strings.Index(text, query)
+	switch {
+	case idx == -1:
+		return 0, false
+	case text == query:
+		return 1000, true
+	case idx == 0:
+		return 800, true
+	case strings.HasPrefix(path.Base(text), query):
+		return 700, true
+	default:
+		if idx > 100 {
+			idx = 100
+		}
+		return 500 - idx, true
+	}
+}
+
+// subsequenceScore scores query as a case-insensitive subsequence of text, so that "githb" matches "github".
+// Consecutive characters and characters at the start of words score higher.
+func subsequenceScore(query, text string) (int, bool) {
+	query, text = strings.ToLower(query), strings.ToLower(text)
+	q := []rune(query)
+	t := []rune(text)
+
+	score := 300
+	qi := 0
+	last := -1
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		if last >= 0 {
+			gap := ti - last - 1
+			if gap == 0 {
+				score += 5
+			} else if gap < 10 {
+				score -= gap
+			} else {
+				score -= 10
+			}
+		}
+		if ti == 0 || strings.ContainsRune("/-_. ", t[ti-1]) {
+			score += 3
+		}
+		last = ti
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	if score <= 100 {
+		score = 101
+	}
+	return score, true
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
+
+// typoScore scores query against text, or against the last path element of text, allowing a few typos.
+func typoScore(query, text string) (int, bool) {
+	query, text = strings.ToLower(query), strings.ToLower(text)
+	distance := editDistance(query, text)
+	if baseDistance := editDistance(query, path.Base(text)); baseDistance < distance {
+		distance = baseDistance
+	}
+	if distance > (len(query)+2)/3 {
+		return 0, false
+	}
+	return 100 - 10*distance, true
+}
+
+// fuzzyScore combines substringScore, subsequenceScore and typoScore, in that order of preference.
+func fuzzyScore(query, text string) (int, bool) {
+	for _, score := range []func(string, string) (int, bool){substringScore, subsequenceScore, typoScore} {
+		if s, ok := score(query, text); ok {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// searchEntries returns the entries matching query, best matches first.
+// Names are matched in the given mode, descriptions by substring or regular expression only,
+// and description matches rank below name matches.
+func searchEntries(entries []passulib.PasswordEntry, query string, mode int) ([]searchResult, error) {
+	nameScore := substringScore
+	descriptionScore := substringScore
+	switch mode {
+	case searchFuzzy:
+		nameScore = fuzzyScore
+	case searchRegex:
+		re, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression: %v", err)
+		}
+		nameScore = func(query, text string) (int, bool) {
+			return 500, re.MatchString(text)
+		}
+		descriptionScore = nameScore
+	}
+
+	results := make([]searchResult, 0)
+	for _, entry := range entries {
+		if score, ok := nameScore(query, entry.Name); ok {
+			results = append(results, searchResult{Entry: entry, Field: "name", Score: score})
+		} else if score, ok := descriptionScore(query, entry.Description); ok && entry.Description != "" {
+			results = append(results, searchResult{Entry: entry, Field: "description", Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Field != results[j].Field {
+			return results[i].Field == "name"
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Entry.Name < results[j].Entry.Name
+	})
+	return results, nil
+}
+
+// closestEntries returns the names of the entries that best match name, for suggestions.
+func closestEntries(db *passulib.PasswordDatabase, name string) []string {
+	results, _ := searchEntries(db.AllEntries(), name, searchFuzzy)
+
+	names := make([]string, 0, suggestionLimit)
+	for _, result := range results {
+		if result.Field != "name" || len(names) == suggestionLimit {
+			break
+		}
+		names = append(names, result.Entry.Name)
+	}
+	return names
+}
+
+type entryNotFoundError struct {
+	suggestions []string
+}
+
+func (e *entryNotFoundError) Error() string {
+	return fmt.Sprintf("%v. Did you mean: %v?", ErrEntryNotFound, strings.Join(e.suggestions, ", "))
+}
+
+func (e *entryNotFoundError) Is(target error) bool {
+	return target == ErrEntryNotFound
+}
+
+// entryNotFound returns an error matching ErrEntryNotFound that suggests the closest entries to name, if there are any.
+func entryNotFound(db *passulib.PasswordDatabase, name string) error {
+	suggestions := closestEntries(db, name)
+	if len(suggestions) == 0 {
+		return ErrEntryNotFound
+	}
+	return &entryNotFoundError{suggestions: suggestions}
+}
+
+func searchCommand(db *passulib.PasswordDatabase, settings *PromptSettings) cli.Command {
+	return cli.Command{
+		Name:      "search",
+		Usage:     "Search password entries by name and description",
+		ArgsUsage: "<query>",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "fuzzy, f",
+				Usage: "Also match names with missing or mistyped characters",
+			},
+			cli.BoolFlag{
+				Name:  "regex, r",
+				Usage: "Treat query as a regular expression",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return missingArgument("query")
+			}
+			if c.Bool("fuzzy") && c.Bool("regex") {
+				return errors.New("Only one of --fuzzy and --regex can be used")
+			}
+
+			mode := searchSubstring
+			if c.Bool("fuzzy") {
+				mode = searchFuzzy
+			} else if c.Bool("regex") {
+				mode = searchRegex
+			}
+
+			results, err := searchEntries(db.AllEntries(), strings.Join(c.Args(), " "), mode)
+			if err != nil {
+				return err
+			}
+
+			data := make([]searchResultOutput, len(results))
+			for idx, result := range results {
+				data[idx] = searchResultOutput{
+					Name:        result.Entry.Name,
+					Description: result.Entry.Description,
+					Field:       result.Field,
+				}
+			}
+			return printData(settings, data, func() {
+				if len(results) == 0 {
+					settings.PrintFunc("No entries found")
+				}
+				for _, result := range results {
+					if result.Field == "description" {
+						settings.PrintFunc(fmt.Sprintf("%v (%v)", result.Entry.Name, result.Entry.Description))
+					} else {
+						settings.PrintFunc(result.Entry.Name)
+					}
+				}
+			})
+		},
+	}
+}
@@ -0,0 +1,230 @@
+package passu
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Shell completion scripts complete the "passu [flags] <password-file> [command...]" form of the command line.
+// They are generated from the command trees and never open the password file,
+// so entry names are not completed.
+
+// CommandTree returns the commands of the prompt, for generating shell completions.
+// The commands are not bound to a database and can't be run.
+func CommandTree() []cli.Command {
+	return NewCompleter(nil, &PromptSettings{}).commands
+}
+
+// completionCase lists the words that can follow a command path, with every combination of aliases in paths.
+// Paths of app commands, which come instead of the password file, start with "+".
+type completionCase struct {
+	paths []string
+	words []string
+	files bool // Whether file names can follow as well
+}
+
+type completionSpec struct {
+	globalWords []string // Flags and commands that can come before the password file
+	appCommands []string
+	valueFlags  []string // Flags that are followed by a value
+	cases       []completionCase
+}
+
+// argumentChoices returns the choices of an argument written like "bash|zsh|fish" in argsUsage.
+func argumentChoices(argsUsage string) []string {
+	for _, arg := range strings.Fields(argsUsage) {
+		if strings.Contains(arg, "|") {
+			return strings.Split(strings.Trim(arg, "<>[]"), "|")
+		}
+	}
+	return nil
+}
+
+func valueFlagNames(flags []cli.Flag) []string {
+	names := make([]string, 0)
+	for _, name := range flagNames(flags) {
+		if flagTakesValue(flags, strings.TrimLeft(name, "-")) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func promptCompletionCases(commands []cli.Command, prefixes []string) ([]completionCase, []string) {
+	cases := make([]completionCase, 0)
+	valueFlags := make([]string, 0)
+	for _, command := range commands {
+		paths := make([]string, 0)
+		for _, prefix := range prefixes {
+			for _, name := range command.Names() {
+				paths = append(paths, strings.TrimSpace(prefix+" "+name))
+			}
+		}
+
+		cases = append(cases, completionCase{
+			paths: paths,
+			words: append(commandNames(command.Subcommands, false), flagNames(command.Flags)...),
+			files: strings.Contains(command.ArgsUsage, "file"),
+		})
+		valueFlags = append(valueFlags, valueFlagNames(command.Flags)...)
+
+		subCases, subFlags := promptCompletionCases(command.Subcommands, paths)
+		cases = append(cases, subCases...)
+		valueFlags = append(valueFlags, subFlags...)
+	}
+	return cases, valueFlags
+}
+
+func newCompletionSpec(app *cli.App) completionSpec {
+	tree := CommandTree()
+	spec := completionSpec{
+		globalWords: flagNames(app.Flags),
+		appCommands: commandNames(app.Commands, true),
+		valueFlags:  valueFlagNames(app.Flags),
+	}
+	spec.globalWords = append(spec.globalWords, commandNames(app.Commands, false)...)
+
+	for _, command := range app.Commands {
+		paths := make([]string, 0)
+		for _, name := range command.Names() {
+			paths = append(paths, "+"+name)
+		}
+
+		choices := argumentChoices(command.ArgsUsage)
+		spec.cases = append(spec.cases, completionCase{
+			paths: paths,
+			words: append(choices, flagNames(command.Flags)...),
+			files: len(choices) == 0 && command.ArgsUsage != "",
+		})
+		spec.valueFlags = append(spec.valueFlags, valueFlagNames(command.Flags)...)
+	}
+
+	spec.cases = append(spec.cases, completionCase{paths: []string{""}, words: commandNames(tree, false)})
+	cases, valueFlags := promptCompletionCases(tree, []string{""})
+	spec.cases = append(spec.cases, cases...)
+	spec.valueFlags = append(spec.valueFlags, valueFlags...)
+
+	sort.Strings(spec.valueFlags)
+	unique := spec.valueFlags[:0]
+	for idx, flag := range spec.valueFlags {
+		if idx == 0 || flag != spec.valueFlags[idx-1] {
+			unique = append(unique, flag)
+		}
+	}
+	spec.valueFlags = unique
+
+	return spec
+}
+
+// WriteCompletionScript writes a completion script for shell, which is bash, zsh or fish, to w.
+func WriteCompletionScript(w io.Writer, shell string, app *cli.App) error {
+	spec := newCompletionSpec(app)
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, app.Name, spec)
+	case "zsh":
+		fmt.Fprintf(w, "#compdef %v\n\nautoload -U +X bashcompinit && bashcompinit\n\n", app.Name)
+		writeBashCompletion(w, app.Name, spec)
+	case "fish":
+		writeFishCompletion(w, app.Name, spec)
+	default:
+		return fmt.Errorf("Unsupported shell %q. Use bash, zsh or fish", shell)
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, name string, spec completionSpec) {
+	function := "_" + strings.Replace(name, "-", "_", -1)
+
+	fmt.Fprintf(w, "# bash completion for %v\n", name)
+	fmt.Fprintf(w, "%v() {\n", function)
+	fmt.Fprint(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]}\n")
+	fmt.Fprint(w, "\tlocal path=\"\" file=0 skip=0 files=0 words=\"\" i w\n")
+	fmt.Fprint(w, "\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+	fmt.Fprint(w, "\t\tw=${COMP_WORDS[i]}\n")
+	fmt.Fprint(w, "\t\tif ((skip)); then\n\t\t\tskip=0\n\t\t\tcontinue\n\t\tfi\n")
+	fmt.Fprint(w, "\t\tcase $w in\n")
+	if len(spec.valueFlags) > 0 {
+		fmt.Fprintf(w, "\t\t%v)\n\t\t\tskip=1\n\t\t\tcontinue\n\t\t\t;;\n", strings.Join(spec.valueFlags, " | "))
+	}
+	fmt.Fprint(w, "\t\t-*)\n\t\t\tcontinue\n\t\t\t;;\n")
+	fmt.Fprint(w, "\t\tesac\n")
+	fmt.Fprint(w, "\t\tif ((file)); then\n")
+	fmt.Fprint(w, "\t\t\t[[ $path == +* ]] || path=\"${path:+$path }$w\"\n")
+	fmt.Fprintf(w, "\t\telif [[ \" %v \" == *\" $w \"* ]]; then\n", strings.Join(spec.appCommands, " "))
+	fmt.Fprint(w, "\t\t\tpath=\"+$w\"\n\t\t\tfile=1\n")
+	fmt.Fprint(w, "\t\telse\n\t\t\tfile=1\n\t\tfi\n")
+	fmt.Fprint(w, "\tdone\n\n")
+
+	fmt.Fprint(w, "\tif ((!file)); then\n")
+	fmt.Fprintf(w, "\t\twords=\"%v\"\n\t\tfiles=1\n", strings.Join(spec.globalWords, " "))
+	fmt.Fprint(w, "\telse\n\t\tcase $path in\n")
+	for _, c := range spec.cases {
+		quoted := make([]string, len(c.paths))
+		for idx, path := range c.paths {
+			quoted[idx] = fmt.Sprintf("%q", path)
+		}
+		fmt.Fprintf(w, "\t\t%v)\n\t\t\twords=\"%v\"\n", strings.Join(quoted, " | "), strings.Join(c.words, " "))
+		if c.files {
+			fmt.Fprint(w, "\t\t\tfiles=1\n")
+		}
+		fmt.Fprint(w, "\t\t\t;;\n")
+	}
+	fmt.Fprint(w, "\t\tesac\n\tfi\n\n")
+
+	fmt.Fprint(w, "\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprint(w, "\tif ((files)); then\n\t\tCOMPREPLY+=($(compgen -f -- \"$cur\"))\n\tfi\n")
+	fmt.Fprint(w, "}\n")
+	fmt.Fprintf(w, "complete -F %v %v\n", function, name)
+}
+
+func writeFishCompletion(w io.Writer, name string, spec completionSpec) {
+	function := "__" + strings.Replace(name, "-", "_", -1)
+
+	fmt.Fprintf(w, "# fish completion for %v\n", name)
+	fmt.Fprintf(w, "function %v_path\n", function)
+	fmt.Fprint(w, "\tset -l words (commandline -opc)\n\tset -e words[1]\n")
+	fmt.Fprint(w, "\tset -l file 0\n\tset -l skip 0\n\tset -l path\n")
+	fmt.Fprint(w, "\tfor w in $words\n")
+	fmt.Fprint(w, "\t\tif test $skip = 1\n\t\t\tset skip 0\n\t\t\tcontinue\n\t\tend\n")
+	fmt.Fprint(w, "\t\tswitch $w\n")
+	if len(spec.valueFlags) > 0 {
+		fmt.Fprintf(w, "\t\t\tcase %v\n\t\t\t\tset skip 1\n\t\t\t\tcontinue\n", strings.Join(spec.valueFlags, " "))
+	}
+	fmt.Fprint(w, "\t\t\tcase '-*'\n\t\t\t\tcontinue\n\t\tend\n")
+	fmt.Fprint(w, "\t\tif test $file = 1\n")
+	fmt.Fprint(w, "\t\t\tstring match -q -- '+*' \"$path\"; or set path $path $w\n")
+	fmt.Fprintf(w, "\t\telse if contains -- $w %v\n", strings.Join(spec.appCommands, " "))
+	fmt.Fprint(w, "\t\t\tset path \"+$w\"\n\t\t\tset file 1\n")
+	fmt.Fprint(w, "\t\telse\n\t\t\tset file 1\n\t\tend\n")
+	fmt.Fprint(w, "\tend\n")
+	fmt.Fprint(w, "\tif test $file = 0\n\t\techo '<file>'\n\telse\n\t\techo (string join ' ' -- $path)\n\tend\n")
+	fmt.Fprint(w, "end\n\n")
+
+	fmt.Fprintf(w, "function %v_complete\n", function)
+	fmt.Fprint(w, "\tset -l files 0\n")
+	fmt.Fprintf(w, "\tset -l path (%v_path)\n", function)
+	fmt.Fprint(w, "\tswitch \"$path\"\n")
+	fmt.Fprintf(w, "\t\tcase '<file>'\n\t\t\tprintf '%%s\\n' %v\n\t\t\tset files 1\n", strings.Join(spec.globalWords, " "))
+	for _, c := range spec.cases {
+		quoted := make([]string, len(c.paths))
+		for idx, path := range c.paths {
+			quoted[idx] = fmt.Sprintf("'%v'", path)
+		}
+		fmt.Fprintf(w, "\t\tcase %v\n", strings.Join(quoted, " "))
+		if len(c.words) > 0 {
+			fmt.Fprintf(w, "\t\t\tprintf '%%s\\n' %v\n", strings.Join(c.words, " "))
+		}
+		if c.files {
+			fmt.Fprint(w, "\t\t\tset files 1\n")
+		}
+	}
+	fmt.Fprint(w, "\tend\n")
+	fmt.Fprint(w, "\tif test $files = 1\n\t\t__fish_complete_path (commandline -ct)\n\tend\n")
+	fmt.Fprint(w, "end\n\n")
+
+	fmt.Fprintf(w, "complete -c %v -f -a '(%v_complete)'\n", name, function)
+}
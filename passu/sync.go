@@ -0,0 +1,168 @@
+package passu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/winded/passu-lib"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// FileState identifies the version of a database file on disk.
+type FileState struct {
+	Hash    string
+	ModTime time.Time
+}
+
+// Known reports whether the state has been recorded.
+func (s FileState) Known() bool {
+	return s.Hash != ""
+}
+
+// ReadFileState reads the current state of the file at filePath.
+func ReadFileState(filePath string) (FileState, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return FileState{}, err
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return FileState{}, err
+	}
+
+	return FileStateFromData(data, stat.ModTime()), nil
+}
+
+// FileStateFromData returns the state of a file with the given contents and modification time.
+func FileStateFromData(data []byte, modTime time.Time) FileState {
+	hash := sha256.Sum256(data)
+	return FileState{
+		Hash:    hex.EncodeToString(hash[:]),
+		ModTime: modTime,
+	}
+}
+
+// fileChanged reports whether the database file differs from the version that was loaded or last saved.
+// When quick is set, the file is only hashed if its modification time has changed.
+func fileChanged(settings *PromptSettings, quick bool) (bool, error) {
+	if !settings.FileState.Known() {
+		return false, nil
+	}
+
+	if quick {
+		stat, err := os.Stat(settings.FilePath)
+		if err != nil {
+			return false, err
+		}
+		if stat.ModTime().Equal(settings.FileState.ModTime) {
+			return false, nil
+		}
+	}
+
+	current, err := ReadFileState(settings.FilePath)
+	if err != nil {
+		return false, err
+	}
+	if current.Hash == settings.FileState.Hash {
+		settings.FileState = current
+		return false, nil
+	}
+	return true, nil
+}
+
+// openDiskDatabase opens the current version of the database file.
+// The master password is asked for if the file no longer opens with the current one.
+func openDiskDatabase(settings *PromptSettings) (*passulib.PasswordDatabase, FileState, string, error) {
+	stat, err := os.Stat(settings.FilePath)
+	if err != nil {
+		return nil, FileState{}, "", err
+	}
+	data, err := ioutil.ReadFile(settings.FilePath)
+	if err != nil {
+		return nil, FileState{}, "", err
+	}
+	state := FileStateFromData(data, stat.ModTime())
+
+	diskDb, password, err := openDatabaseData(data, "Master password of the file on disk: ", settings)
+	if err != nil {
+		return nil, FileState{}, "", err
+	}
+	return diskDb, state, password, nil
+}
+
+// reloadDatabase replaces the contents of db with the database file on disk, discarding local changes.
+func reloadDatabase(db *passulib.PasswordDatabase, settings *PromptSettings) error {
+	diskDb, state, password, err := openDiskDatabase(settings)
+	if err != nil {
+		return err
+	}
+
+	err = replaceContents(db, diskDb)
+	if err != nil {
+		return err
+	}
+	if password != settings.MasterPassword {
+		db.SetPassword(password)
+		settings.MasterPassword = password
+	}
+
+	db.Modified = false
+	settings.FileState = state
+	sessionJournal(db, settings).reset(db, settings)
+	return nil
+}
+
+// mergeFromDisk merges the database file on disk into db, using the state of the file when it was
+// loaded or last saved as the base. For entries changed on both sides the user picks which version to keep.
+func mergeFromDisk(db *passulib.PasswordDatabase, settings *PromptSettings) error {
+	diskDb, state, _, err := openDiskDatabase(settings)
+	if err != nil {
+		return err
+	}
+
+	base := passulib.NewPasswordDatabase(settings.MasterPassword)
+	err = sessionJournal(db, settings).saved.restore(base, nil)
+	if err != nil {
+		return err
+	}
+
+	applied, _, err := mergeDatabases(base, db, diskDb, promptResolver(settings, "l", "d"))
+	if err != nil {
+		return err
+	}
+
+	printMessage(settings, fmt.Sprintf("Merged %v changes from disk", applied))
+	settings.FileState = state
+	return nil
+}
+
+// resolveFileChange asks how to handle a database file that has changed on disk before it is overwritten.
+// It returns true if the save should continue.
+func resolveFileChange(db *passulib.PasswordDatabase, settings *PromptSettings) (bool, error) {
+	printInstruction(settings, "The database file has changed on disk since it was loaded.")
+
+	switch promptChoice("[r]eload from disk, [m]erge, [f]orce overwrite or [c]ancel: ", settings) {
+	case "r":
+		err := reloadDatabase(db, settings)
+		if err != nil {
+			return false, err
+		}
+		printMessage(settings, "Database reloaded from disk. Local changes were discarded.")
+		return false, nil
+	case "m":
+		err := mergeFromDisk(db, settings)
+		return err == nil, err
+	case "f":
+		return true, nil
+	default:
+		return false, errors.New("Save cancelled")
+	}
+}
+
+// replaceContents replaces all entries and the default policy of db with those of source.
+func replaceContents(db, source *passulib.PasswordDatabase) error {
+	return databaseSnapshot(source).restore(db, nil)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/kballard/go-shellquote"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const passwordFdEnv = "PASSU_PASSWORD_FD"
+
+var passwordFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "password-stdin",
+		Usage: "Read the master password from standard input",
+	},
+	cli.StringFlag{
+		Name:  "password-file",
+		Usage: "Read the master password from a file",
+	},
+	cli.StringFlag{
+		Name:  "password-command",
+		Usage: "Run a command and use its output as the master password",
+	},
+	cli.IntFlag{
+		Name:  "password-attempts",
+		Value: 3,
+		Usage: "Number of times a wrong master password can be entered in the terminal",
+	},
+}
+
+// trimNewline removes a single trailing line break, so that passwords may contain other whitespace.
+func trimNewline(data []byte) string {
+	text := string(data)
+	text = strings.TrimSuffix(text, "\n")
+	text = strings.TrimSuffix(text, "\r")
+	return text
+}
+
+func readPasswordCommand(command string) (string, error) {
+	args, err := shellquote.Split(command)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", errors.New("Empty password command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Password command failed: %v", err)
+	}
+
+	return trimNewline(output), nil
+}
+
+func readPasswordFd(value string) (string, error) {
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("Invalid %v value %q", passwordFdEnv, value)
+	}
+
+	f := os.NewFile(uintptr(fd), passwordFdEnv)
+	if f == nil {
+		return "", fmt.Errorf("Invalid %v value %q", passwordFdEnv, value)
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return trimNewline(data), nil
+}
+
+// passwordSource returns a function reading the master password from the source selected
+// by command line options or the environment, or nil if the password should be asked from the terminal.
+// Without a source and without a terminal, an error is returned instead of failing on the first prompt.
+func passwordSource(c *cli.Context) (func() (string, error), error) {
+	var read func() (string, error)
+	sources := 0
+
+	if c.GlobalBool("password-stdin") {
+		sources++
+		read = func() (string, error) {
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return "", err
+			}
+			return trimNewline(data), nil
+		}
+	}
+	if file := c.GlobalString("password-file"); file != "" {
+		sources++
+		read = func() (string, error) {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return "", err
+			}
+			return trimNewline(data), nil
+		}
+	}
+	if command := c.GlobalString("password-command"); command != "" {
+		sources++
+		read = func() (string, error) {
+			return readPasswordCommand(command)
+		}
+	}
+	if fd := os.Getenv(passwordFdEnv); fd != "" && sources == 0 {
+		sources++
+		read = func() (string, error) {
+			return readPasswordFd(fd)
+		}
+	}
+
+	if sources > 1 {
+		return nil, errors.New("Only one of --password-stdin, --password-file and --password-command can be used.")
+	}
+	if read == nil {
+		if !readline.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("No terminal to read the master password from. Use --password-stdin, --password-file, --password-command or %v.", passwordFdEnv)
+		}
+		return nil, nil
+	}
+
+	// The source is read only once, since stdin and file descriptors cannot be read again
+	password, readErr := "", error(nil)
+	done := false
+	return func() (string, error) {
+		if !done {
+			password, readErr = read()
+			done = true
+		}
+		return password, readErr
+	}, nil
+}